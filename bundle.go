@@ -0,0 +1,70 @@
+package main
+
+import (
+	"archive/zip"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// writeBundle packages the output CSV and every file in audioDir into a zip
+// archive at path. The archive mirrors the layout on disk, so the CSV sits at
+// the top and the audio files keep their directory name next to it.
+func writeBundle(path, csvPath, audioDir string) (err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	zw := zip.NewWriter(f)
+	if err := addToZip(zw, csvPath, filepath.Base(csvPath)); err != nil {
+		return err
+	}
+	// Subdirectories, e.g. from -audio-naming-template, are kept.
+	err = filepath.WalkDir(audioDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(audioDir, path)
+		if err != nil {
+			return err
+		}
+		return addToZip(zw, path, filepath.ToSlash(filepath.Join(filepath.Base(audioDir), rel)))
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// addToZip copies the file at path into zw under name.
+func addToZip(zw *zip.Writer, path, name string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+	w, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, src)
+	return err
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// utf8BOM is the byte order mark some Windows tools put at the start of
+// UTF-8 files.
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// cp1251High maps the bytes 0x80-0xBF of Windows-1251 to Unicode. The bytes
+// 0xC0-0xFF are А-я in alphabetical order and are computed instead.
+var cp1251High = [64]rune{
+	'Ђ', 'Ѓ', '‚', 'ѓ', '„', '…', '†', '‡', '€', '‰', 'Љ', '‹', 'Њ', 'Ќ', 'Ћ', 'Џ',
+	'ђ', '‘', '’', '“', '”', '•', '–', '—', utf8.RuneError, '™', 'љ', '›', 'њ', 'ќ', 'ћ', 'џ',
+	' ', 'Ў', 'ў', 'Ј', '¤', 'Ґ', '¦', '§', 'Ё', '©', 'Є', '«', '¬', '­', '®', 'Ї',
+	'°', '±', 'І', 'і', 'ґ', 'µ', '¶', '·', 'ё', '№', 'є', '»', 'ј', 'Ѕ', 'ѕ', 'ї',
+}
+
+// decodeInput converts the contents of a text input to UTF-8 and strips a
+// leading BOM. charset is "utf-8", "windows-1251" or "auto", which takes
+// valid UTF-8 as such and anything else as Windows-1251, the usual encoding
+// of Cyrillic text saved by Excel on Windows.
+func decodeInput(data []byte, charset string) (string, error) {
+	data = bytes.TrimPrefix(data, utf8BOM)
+	switch strings.ToLower(charset) {
+	case "auto":
+		if utf8.Valid(data) {
+			return string(data), nil
+		}
+		return decodeCP1251(data), nil
+	case "utf-8", "utf8":
+		if !utf8.Valid(data) {
+			return "", fmt.Errorf("input is not valid UTF-8; try -input-charset windows-1251")
+		}
+		return string(data), nil
+	case "windows-1251", "cp1251":
+		return decodeCP1251(data), nil
+	}
+	return "", fmt.Errorf("unknown charset %q (want auto, utf-8 or windows-1251)", charset)
+}
+
+// decodeCP1251 converts Windows-1251 text to UTF-8.
+func decodeCP1251(data []byte) string {
+	var b strings.Builder
+	b.Grow(len(data) * 2)
+	for _, c := range data {
+		switch {
+		case c < 0x80:
+			b.WriteByte(c)
+		case c < 0xC0:
+			b.WriteRune(cp1251High[c-0x80])
+		default:
+			b.WriteRune('А' + rune(c-0xC0))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/yalexaner/simply-lingo/lingo"
+)
+
+// checkpoint records how far a run got, so -resume can continue a crashed
+// run exactly where its last flush left the output file.
+type checkpoint struct {
+	Inputs  []string `json:"inputs"`
+	Lang    string   `json:"lang"`
+	Format  string   `json:"format"`
+	Columns []string `json:"columns"`
+	Done    int      `json:"done"`        // number of input words handled up to the last flush
+	Size    int64    `json:"output_size"` // output file size after that flush
+}
+
+// sameSettings reports whether c was written by a run whose output can be
+// continued by a run with the settings of other.
+func (c checkpoint) sameSettings(other checkpoint) bool {
+	return slices.Equal(c.Inputs, other.Inputs) && c.Lang == other.Lang && c.Format == other.Format && slices.Equal(c.Columns, other.Columns)
+}
+
+// loadCheckpoint reads the checkpoint at path. ok is false when there is none.
+func loadCheckpoint(path string) (c checkpoint, ok bool, err error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, false, nil
+	}
+	if err != nil {
+		return c, false, err
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, false, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return c, true, nil
+}
+
+// saveCheckpoint replaces the checkpoint at path.
+func saveCheckpoint(path string, c checkpoint) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return lingo.WriteFileAtomic(path, data)
+}
+
+// checkResumable checks that the first c.Size bytes of the output, the ones
+// -resume keeps, are whole rows that parse and that the audio files they
+// reference are in audioDir.
+func checkResumable(format outputFormat, audioDir string, c checkpoint) error {
+	f, err := os.Open(format.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() < c.Size {
+		return fmt.Errorf("%s is shorter than when the checkpoint was written", format.path)
+	}
+	kept, err := io.ReadAll(io.LimitReader(f, c.Size))
+	if err != nil {
+		return err
+	}
+	// Every flush ends with a whole row.
+	if len(kept) > 0 && kept[len(kept)-1] != '\n' {
+		return fmt.Errorf("%s doesn't end a row where the checkpoint says", format.path)
+	}
+	var report verifyReport
+	if _, err := checkRefs(format.newReader(bytes.NewReader(kept)), audioDir, &report); err != nil {
+		return fmt.Errorf("parsing %s: %w", format.path, err)
+	}
+	if len(report.dangling) > 0 {
+		return fmt.Errorf("%d audio files referenced by %s are missing, e.g. %s", len(report.dangling), format.path, report.dangling[0])
+	}
+	return nil
+}
+
+// resumeEntries continues the run whose checkpoint is at checkpointFile,
+// cutting the output back to it and returning the entries it didn't get to.
+// ok is false, and the run starts from scratch, when there is no checkpoint,
+// it was written with other settings than progress, or the output it kept
+// no longer checks out (see checkResumable).
+func resumeEntries(checkpointFile string, format outputFormat, audioDir string, progress checkpoint, entries []lingo.Entry, logs *lingo.Logger) (rest []lingo.Entry, ok bool, err error) {
+	saved, ok, err := loadCheckpoint(checkpointFile)
+	switch {
+	case err != nil:
+		return nil, false, fmt.Errorf("Failed to read %s: %w", checkpointFile, err)
+	case !ok:
+		logs.Infof("No checkpoint in %s, starting from scratch", checkpointFile)
+		return entries, false, nil
+	case !saved.sameSettings(progress):
+		logs.Warnf("%s was written with other settings, starting from scratch", checkpointFile)
+		return entries, false, nil
+	}
+	if err := checkResumable(format, audioDir, saved); err != nil {
+		logs.Warnf("Can't resume from %s, starting from scratch: %v", checkpointFile, err)
+		return entries, false, nil
+	}
+	if err := os.Truncate(format.path, saved.Size); err != nil {
+		return nil, false, fmt.Errorf("Failed to resume %s: %w", format.path, err)
+	}
+	skipped := min(saved.Done, len(entries))
+	logs.Infof("Resuming after %d words", skipped)
+	return entries[skipped:], true, nil
+}
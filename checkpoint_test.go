@@ -0,0 +1,69 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yalexaner/simply-lingo/lingo"
+)
+
+func TestResumeEntries(t *testing.T) {
+	// The crashed run flushed cat and dog, then got halfway through fish.
+	kept := "cat;pet;[sound:cat.mp3];кошка\ndog;pet;[sound:dog.mp3];собака\n"
+	tests := []struct {
+		name   string
+		output string
+		audio  []string
+		wantOK bool
+	}{
+		{name: "intact", output: kept + "fish;pe", audio: []string{"cat.mp3", "dog.mp3"}, wantOK: true},
+		{name: "corrupted tail", output: kept[:len(kept)-8] + "\"broken\n", audio: []string{"cat.mp3", "dog.mp3"}},
+		{name: "missing audio", output: kept, audio: []string{"cat.mp3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			format := outputFormat{path: filepath.Join(dir, "output.csv"), comma: ';'}
+			if err := os.WriteFile(format.path, []byte(tt.output), 0644); err != nil {
+				t.Fatal(err)
+			}
+			audioDir := filepath.Join(dir, "audio")
+			os.Mkdir(audioDir, 0755)
+			for _, name := range tt.audio {
+				os.WriteFile(filepath.Join(audioDir, name), fakeAudio(name), 0644)
+			}
+			progress := checkpoint{Inputs: []string{"words.tsv"}, Lang: "en-ru", Format: "csv"}
+			saved := progress
+			saved.Done, saved.Size = 2, int64(len(kept))
+			checkpointFile := filepath.Join(dir, "checkpoint.json")
+			if err := saveCheckpoint(checkpointFile, saved); err != nil {
+				t.Fatal(err)
+			}
+
+			entries := []lingo.Entry{{Seq: 0, Word: "cat"}, {Seq: 1, Word: "dog"}, {Seq: 2, Word: "fish"}}
+			logs := lingo.NewLogger(lingo.LevelQuiet, io.Discard, io.Discard)
+			rest, ok, err := resumeEntries(checkpointFile, format, audioDir, progress, entries, logs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				// Starting from scratch leaves the output to be rewritten.
+				if len(rest) != len(entries) {
+					t.Errorf("rest has %d entries, want all %d", len(rest), len(entries))
+				}
+				return
+			}
+			if len(rest) != 1 || rest[0].Word != "fish" {
+				t.Errorf("rest = %+v, want fish", rest)
+			}
+			if got := readLines(t, format.path); len(got) != 2 {
+				t.Errorf("output has %d rows after resuming, want the 2 flushed", len(got))
+			}
+		})
+	}
+}
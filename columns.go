@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/yalexaner/simply-lingo/lingo"
+)
+
+// Names of the columns that can appear in the output file.
+const (
+	columnIndex         = "index"
+	columnWord          = "word"
+	columnTranscription = "transcription"
+	columnExample       = "example"
+	columnSound         = "sound"
+	columnExampleSound  = "example_sound"
+	columnTranslation   = "translation"
+	columnPos           = "pos"
+	columnTags          = "tags"
+	columnSynonyms      = "synonyms"
+	// columnDefinitionTranslation holds the machine translation of the
+	// definition, see -translate-definition.
+	columnDefinitionTranslation = "definition_translation"
+)
+
+// knownColumns lists every column name, in the order the usage message gives
+// them.
+var knownColumns = []string{columnIndex, columnWord, columnTranscription, columnExample, columnSound, columnExampleSound, columnTranslation, columnPos, columnSynonyms, columnDefinitionTranslation, columnTags}
+
+// parseColumnSpec parses a -columns list such as "word,translation,sound"
+// into the output columns, rejecting unknown and repeated names.
+func parseColumnSpec(spec string) ([]string, error) {
+	var columns []string
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch {
+		case name == "":
+			continue
+		case !slices.Contains(knownColumns, name):
+			return nil, fmt.Errorf("unknown column %q (want %s)", name, strings.Join(knownColumns, ", "))
+		case slices.Contains(columns, name):
+			return nil, fmt.Errorf("column %q is listed twice", name)
+		}
+		columns = append(columns, name)
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no columns listed")
+	}
+	return columns, nil
+}
+
+// columnOptions selects the optional output columns.
+type columnOptions struct {
+	index    bool
+	pos      bool
+	reverse  bool // translation on the front, word and its audio on the back
+	tags     bool
+	synonyms bool
+	// exampleSound adds the audio of the example sentence after the word's.
+	exampleSound          bool
+	transcription         bool
+	definitionTranslation bool
+}
+
+// outputColumns returns the output columns in the order they are written.
+func outputColumns(opts columnOptions) []string {
+	front := []string{columnWord}
+	if opts.transcription {
+		front = append(front, columnTranscription)
+	}
+	front = append(front, columnExample, columnSound)
+	if opts.exampleSound {
+		front = append(front, columnExampleSound)
+	}
+	back := []string{columnTranslation}
+	if opts.pos {
+		back = append(back, columnPos)
+	}
+	if opts.synonyms {
+		back = append(back, columnSynonyms)
+	}
+	if opts.definitionTranslation {
+		back = append(back, columnDefinitionTranslation)
+	}
+	if opts.reverse {
+		front, back = back, front
+	}
+	columns := append(front, back...)
+	if opts.tags {
+		columns = append(columns, columnTags)
+	}
+	if opts.index {
+		// The source row number stays stable across runs, unlike a running counter.
+		columns = append([]string{columnIndex}, columns...)
+	}
+	return columns
+}
+
+// columnPosition returns the position of the named column, or -1.
+func columnPosition(columns []string, name string) int {
+	for i, column := range columns {
+		if column == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// card holds the parts of an output row that can differ between the rows
+// written for a single entry.
+type card struct {
+	index   string // the index column, see cardOptions.sourceIndex
+	example string
+	// exampleAudioFile is the spoken example, e's ExampleAudioFile unless
+	// the card shows one of its dictionary examples.
+	exampleAudioFile string
+	translation      string
+	pos              string
+	synonyms         string
+}
+
+// record builds the output row for e showing card c.
+func record(e *lingo.Entry, columns []string, c card) []string {
+	record := make([]string, len(columns))
+	for i, column := range columns {
+		switch column {
+		case columnIndex:
+			record[i] = c.index
+		case columnWord:
+			record[i] = e.Word
+		case columnTranscription:
+			record[i] = e.Dictionary.Transcription
+		case columnExample:
+			record[i] = c.example
+		case columnSound:
+			// Format for Anki: [sound:filename.ext]
+			if e.AudioFile != "" {
+				record[i] = soundField(e.AudioFile)
+			}
+		case columnExampleSound:
+			if c.exampleAudioFile != "" {
+				record[i] = soundField(c.exampleAudioFile)
+			}
+		case columnTranslation:
+			record[i] = c.translation
+		case columnPos:
+			record[i] = c.pos
+		case columnSynonyms:
+			record[i] = c.synonyms
+		case columnDefinitionTranslation:
+			record[i] = e.DefinitionTranslation
+		case columnTags:
+			record[i] = e.Tags
+		}
+	}
+	return record
+}
+
+// chosenSynonyms returns the synonyms of the sense e's translation was taken
+// from.
+func chosenSynonyms(e *lingo.Entry) []string {
+	for _, sense := range e.Dictionary.Senses {
+		if sense.Text == e.Translation && sense.Pos == e.Pos {
+			return sense.Synonyms
+		}
+	}
+	return nil
+}
+
+// soundField returns the Anki reference to an audio file.
+func soundField(filename string) string {
+	return "[sound:" + filename + "]"
+}
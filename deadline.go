@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+)
+
+// contextTransport ties every request to ctx in addition to the request's own
+// context, so cancelling ctx aborts requests that are still in flight. The
+// providers build their requests without a context of their own.
+type contextTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+func (t contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	stop := context.AfterFunc(t.ctx, cancel)
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		stop()
+		cancel()
+		return nil, err
+	}
+	// The body is read after RoundTrip returns, so the request stays
+	// cancellable until it is closed.
+	resp.Body = cancelOnClose{resp.Body, func() {
+		stop()
+		cancel()
+	}}
+	return resp, nil
+}
+
+// cancelOnClose calls release once the wrapped body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
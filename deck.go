@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yalexaner/simply-lingo/lingo"
+)
+
+// cardOptions controls which rows a finished entry is written as.
+type cardOptions struct {
+	// expand writes a card for every distinct translation; join lists them
+	// in a single field instead.
+	expand, join    bool
+	maxTranslations int
+	rankFilter      lingo.RankFilter
+	fieldSeparator  string
+	// explodeExamples writes a card for each of the first maxExamples
+	// dictionary examples in place of the spreadsheet definition.
+	explodeExamples bool
+	maxExamples     int
+	// sourceIndex prefixes the row number of the index column with the
+	// input it was read from, so it stays unique across several inputs.
+	sourceIndex bool
+}
+
+// deckWriter writes the rows of finished entries to the output, flushing and
+// checkpointing it as it goes.
+type deckWriter struct {
+	rows      rowWriter
+	file      *os.File
+	format    outputFormat
+	columns   []string
+	cards     cardOptions
+	streaming bool // the rows go to stdout
+	// Every flushEvery entries the output is synced and a checkpoint saved
+	// to checkpointFile, so a crash late in a long run doesn't lose
+	// everything still buffered in memory.
+	flushEvery     int
+	checkpointFile string
+	progress       checkpoint
+	post           *postProcessor
+	postprocess    string // the -postprocess command, for the log
+	logs           *lingo.Logger
+
+	written      int            // entries written
+	writtenWords map[string]int // input -> entries written from it
+}
+
+// writeEntry writes the rows of e. A -postprocess error leaves out all of
+// them and is returned.
+func (w *deckWriter) writeEntry(e *lingo.Entry) error {
+	// With -expand-translations every distinct translation becomes its own
+	// card; -join-translations lists them in a single field instead.
+	cards := []card{{translation: e.Translation, pos: e.Pos, synonyms: strings.Join(chosenSynonyms(e), w.cards.fieldSeparator)}}
+	if senses := lingo.DistinctSenses(w.cards.rankFilter.Apply(e.Dictionary), w.cards.maxTranslations); len(senses) > 0 {
+		switch {
+		case w.cards.expand:
+			cards = cards[:0]
+			for _, sense := range senses {
+				cards = append(cards, card{translation: sense.Text, pos: sense.Pos, synonyms: strings.Join(sense.Synonyms, w.cards.fieldSeparator)})
+			}
+		case w.cards.join:
+			texts := make([]string, len(senses))
+			for i, sense := range senses {
+				texts[i] = sense.Text
+			}
+			cards[0].translation = strings.Join(texts, w.cards.fieldSeparator)
+		}
+	}
+
+	// With -explode-examples every dictionary example becomes its own card
+	// in place of the spreadsheet definition, with its own audio.
+	examples := []string{e.Definition}
+	exploded := false
+	if w.cards.explodeExamples {
+		if dictExamples := lingo.ExampleSentences(e.Dictionary, w.cards.maxExamples); len(dictExamples) > 0 {
+			examples, exploded = dictExamples, true
+		}
+	}
+
+	index := strconv.Itoa(e.Row)
+	if w.cards.sourceIndex {
+		index = e.Source + ":" + index
+	}
+
+	var rows [][]string
+	for _, c := range cards {
+		for _, example := range examples {
+			c.index = index
+			c.example, c.exampleAudioFile = example, e.ExampleAudioFile
+			if exploded {
+				c.exampleAudioFile = e.ExampleAudioFiles[example]
+			}
+			row := record(e, w.columns, c)
+			if w.post != nil {
+				processed, keep, err := w.post.process(w.columns, row)
+				if err != nil {
+					return err
+				}
+				if !keep {
+					w.logs.For("postprocess_dropped", e.Word).Verbosef("%q left out a row of %s", w.postprocess, e.Word)
+					continue
+				}
+				row = processed
+			}
+			rows = append(rows, row)
+		}
+	}
+	for _, row := range rows {
+		// Write the output row to the CSV, ensuring proper handling of fields with semicolons
+		// The writer handles quoting and escaping as -quote asks
+		if err := w.rows.Write(row); err != nil {
+			w.logs.For("output_failed", e.Word).Errorf("Error writing CSV row for %s: %v", e.Word, err)
+		}
+	}
+
+	w.written++
+	w.writtenWords[e.Source]++
+	if w.streaming {
+		// Whoever reads the stream gets each word's rows as soon as they
+		// are done; there is no file to sync or resume.
+		w.rows.Flush()
+		if err := w.rows.Error(); err != nil {
+			w.logs.Errorf("Error writing to stdout: %v", err)
+		}
+	} else if w.flushEvery > 0 && w.written%w.flushEvery == 0 {
+		w.rows.Flush()
+		if err := w.rows.Error(); err != nil {
+			w.logs.Errorf("Error flushing %s: %v", w.format.path, err)
+		} else if err := w.file.Sync(); err != nil {
+			w.logs.Errorf("Error syncing %s: %v", w.format.path, err)
+		} else if info, err := w.file.Stat(); err != nil {
+			w.logs.Errorf("Error writing checkpoint: %v", err)
+		} else {
+			w.progress.Done, w.progress.Size = e.Seq+1, info.Size()
+			if err := saveCheckpoint(w.checkpointFile, w.progress); err != nil {
+				w.logs.Errorf("Error writing checkpoint: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// deckRun takes the entries of a run through translation and audio to the
+// deck, keeping count of what happened to them.
+type deckRun struct {
+	proc     *lingo.Processor
+	out      *deckWriter
+	failures *failureLog // nil without -failures-file
+	logs     *lingo.Logger
+	timeout  time.Duration
+	// strict leaves out words without a translation.
+	strict            bool
+	postprocessErrors string
+	limit             int
+
+	handled           map[int]bool // entry Seq -> written, failed or dropped
+	failed            int
+	emptyTranslations int
+	limitReached      bool
+	// postErr is the -postprocess error that stopped the run with
+	// -postprocess-errors fail.
+	postErr error
+}
+
+// fail logs and records that action failed for e.
+func (r *deckRun) fail(e *lingo.Entry, action string, err error) {
+	logFailure(r.logs, action, e.Word, err, r.timeout)
+	r.failed++
+	r.handled[e.Seq] = true
+	if err := r.failures.record(e, fmt.Sprintf("%s: %v", action, err)); err != nil {
+		r.logs.For("failure_log_failed", e.Word).Errorf("Error recording failure for %s: %v", e.Word, err)
+	}
+}
+
+// usable reports whether a translated entry should go on to audio and
+// output, counting and (with -strict) dropping ones without a translation.
+func (r *deckRun) usable(e *lingo.Entry) bool {
+	if e.Translation != "" {
+		return true
+	}
+	r.emptyTranslations++
+	if !r.strict {
+		return true
+	}
+	r.logs.For("no_translation", e.Word).Errorf("No translation found for %s, leaving it out", e.Word)
+	r.handled[e.Seq] = true
+	if err := r.failures.record(e, "no translation found"); err != nil {
+		r.logs.For("failure_log_failed", e.Word).Errorf("Error recording failure for %s: %v", e.Word, err)
+	}
+	return false
+}
+
+// write writes e and applies -postprocess-errors to a failure. It reports
+// lingo.Kept when e was written, lingo.Dropped when it failed and was left
+// out, and lingo.Stop when the run has to stop.
+func (r *deckRun) write(e *lingo.Entry) lingo.Outcome {
+	err := r.out.writeEntry(e)
+	if err == nil {
+		r.handled[e.Seq] = true
+		return lingo.Kept
+	}
+	if r.postprocessErrors == "fail" {
+		r.postErr = fmt.Errorf("post-processing %s: %w", e.Word, err)
+		return lingo.Stop
+	}
+	r.fail(e, "post-processing", err)
+	return lingo.Dropped
+}
+
+// process translates, voices and writes entries as they come through the
+// processor's pipeline. total is the number of entries, negative while it
+// isn't known.
+func (r *deckRun) process(ctx context.Context, entries iter.Seq[*lingo.Entry], total int) {
+	processedWords := 0
+	r.logs.Progress(processedWords, total)
+
+	r.proc.Process(ctx, entries, func(e *lingo.Entry, res lingo.Result) lingo.Outcome {
+		if res.Err != nil && ctx.Err() != nil {
+			// Aborted by -deadline rather than a problem with the word;
+			// stop here so the output ends at the last finished word.
+			return lingo.Stop
+		}
+		if res.Err != nil {
+			r.fail(e, res.Action, res.Err)
+			return lingo.Dropped
+		}
+		if !r.usable(e) {
+			return lingo.Dropped
+		}
+
+		// Only written words count towards -limit.
+		if outcome := r.write(e); outcome != lingo.Kept {
+			return outcome
+		}
+
+		// Update progress counter and display
+		processedWords++
+		r.logs.Progress(processedWords, total)
+
+		if r.limit > 0 && processedWords >= r.limit {
+			r.limitReached = true
+			return lingo.Stop
+		}
+		return lingo.Kept
+	})
+}
+
+// processTwoPass translates every entry, reusing the translations saved in
+// passFile, before generating any audio, and writes the entries once both
+// passes are done.
+func (r *deckRun) processTwoPass(ctx context.Context, entries []lingo.Entry, passFile string) error {
+	translations, err := loadPassFile(passFile)
+	if err != nil {
+		return fmt.Errorf("Failed to read %s: %w", passFile, err)
+	}
+	totalWords := len(entries)
+
+	// Pass 1: translate every word, reusing translations from an earlier run.
+	r.logs.Infof("Pass 1/2: translating %d words", totalWords)
+	r.logs.Progress(0, totalWords)
+	translatedWords := 0
+	for i := range entries {
+		if r.limit > 0 && translatedWords >= r.limit {
+			r.limitReached = true
+			break
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		e := &entries[i]
+		if result, ok := translations[e.Term]; ok && e.Override == nil {
+			r.proc.ApplyDictionaryEntry(e, result)
+			r.proc.TranslateDefinition(e)
+		} else if err := r.proc.Translate(e); err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			r.fail(e, "fetching translation", err)
+		} else if e.Override == nil {
+			translations[e.Term] = e.Dictionary
+			if len(translations)%passSaveInterval == 0 {
+				if err := savePassFile(passFile, translations); err != nil {
+					r.logs.Errorf("Error saving translations to %s: %v", passFile, err)
+				}
+			}
+		}
+		if e.Translated && !r.usable(e) {
+			e.Translated = false
+		}
+		if e.Translated {
+			translatedWords++
+		}
+		r.logs.Progress(i+1, totalWords)
+	}
+	if err := savePassFile(passFile, translations); err != nil {
+		r.logs.Errorf("Error saving translations to %s: %v", passFile, err)
+	}
+
+	// Pass 2: generate audio for every translated word.
+	r.logs.Infof("Pass 2/2: generating audio for %d words", totalWords)
+	r.logs.Progress(0, totalWords)
+	for i := range entries {
+		if ctx.Err() != nil {
+			break
+		}
+		e := &entries[i]
+		if e.Translated {
+			if err := r.proc.Voice(e); err != nil {
+				if ctx.Err() != nil {
+					e.Voiced = false
+					break
+				}
+				r.fail(e, "generating audio", err)
+			}
+		}
+		r.logs.Progress(i+1, totalWords)
+	}
+
+	for i := range entries {
+		if entries[i].Translated && entries[i].Voiced && r.write(&entries[i]) == lingo.Stop {
+			break
+		}
+	}
+	return nil
+}
+
+// recordUnhandled adds the entries the run didn't get to, e.g. because of
+// -limit or -deadline, to the failures file with their reason from
+// reasons, so the next retry picks them up.
+func (r *deckRun) recordUnhandled(entries []lingo.Entry, reasons map[int]string) {
+	for i := range entries {
+		if e := &entries[i]; !r.handled[e.Seq] {
+			if err := r.failures.record(e, reasons[e.Seq]); err != nil {
+				r.logs.For("failure_log_failed", e.Word).Errorf("Error recording failure for %s: %v", e.Word, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// decodingTransport decompresses gzip and deflate response bodies. The
+// standard transport only does so for gzip it asked for itself, not when a
+// request sets Accept-Encoding (e.g. through -tts-header) or the server
+// compresses unasked, and the providers parse the body as it arrives.
+type decodingTransport struct {
+	base http.RoundTripper
+}
+
+func (t decodingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	var decoded io.ReadCloser
+	switch encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))); encoding {
+	case "", "identity":
+		return resp, nil
+	case "gzip", "x-gzip":
+		decoded, err = gzip.NewReader(resp.Body)
+	case "deflate":
+		decoded, err = newDeflateReader(resp.Body)
+	default:
+		err = fmt.Errorf("unsupported Content-Encoding %q", encoding)
+	}
+	if err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("decompressing response: %w", err)
+	}
+	resp.Body = decodedBody{decoded, resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return resp, nil
+}
+
+// newDeflateReader reads a deflate body. HTTP defines deflate as zlib
+// framing, but some servers send raw deflate data, so the zlib header is
+// checked first.
+func newDeflateReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+	if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
+
+// decodedBody reads the decompressed body and closes both readers.
+type decodedBody struct {
+	io.ReadCloser
+	body io.ReadCloser
+}
+
+func (b decodedBody) Close() error {
+	b.ReadCloser.Close()
+	return b.body.Close()
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDecodingTransport(t *testing.T) {
+	const body = `{"def": [{"text": "cat", "tr": [{"text": "кошка"}]}]}`
+	compress := func(newWriter func(io.Writer) io.WriteCloser) []byte {
+		var buf bytes.Buffer
+		w := newWriter(&buf)
+		w.Write([]byte(body))
+		w.Close()
+		return buf.Bytes()
+	}
+	rawDeflate := func(w io.Writer) io.WriteCloser {
+		fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+		return fw
+	}
+	tests := []struct {
+		name     string
+		encoding string
+		data     []byte
+		wantErr  bool
+	}{
+		{name: "plain", data: []byte(body)},
+		{name: "identity", encoding: "identity", data: []byte(body)},
+		{name: "gzip", encoding: "gzip", data: compress(func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) })},
+		{name: "x-gzip", encoding: "x-gzip", data: compress(func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) })},
+		{name: "zlib deflate", encoding: "deflate", data: compress(func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) })},
+		{name: "raw deflate", encoding: "Deflate", data: compress(rawDeflate)},
+		{name: "unsupported", encoding: "br", data: []byte(body), wantErr: true},
+		{name: "corrupt gzip", encoding: "gzip", data: []byte(body), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.encoding != "" {
+					w.Header().Set("Content-Encoding", tt.encoding)
+				}
+				w.Write(tt.data)
+			}))
+			defer server.Close()
+
+			// Asking for an encoding keeps the standard transport from
+			// decompressing gzip itself.
+			req, _ := http.NewRequest("GET", server.URL, nil)
+			req.Header.Set("Accept-Encoding", "gzip, deflate")
+			client := &http.Client{Transport: decodingTransport{http.DefaultTransport}}
+			resp, err := client.Do(req)
+			if tt.wantErr {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatal("want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			got, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != body {
+				t.Errorf("body = %q, want %q", got, body)
+			}
+			if resp.Header.Get("Content-Encoding") != "" && tt.encoding != "identity" {
+				t.Errorf("Content-Encoding %q left on the decoded response", resp.Header.Get("Content-Encoding"))
+			}
+		})
+	}
+}
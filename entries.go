@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/yalexaner/simply-lingo/lingo"
+)
+
+// entryOptions controls how readEntries turns input rows into entries.
+type entryOptions struct {
+	retry   bool // the inputs are failures files of -retry-failures
+	charset string
+	stream  bool // read Excel workbooks row by row, see streamXLSXRows
+	// definitionColumns are joined by defSeparator into the definition;
+	// nil takes the second column.
+	definitionColumns   []int
+	defSeparator        string
+	caseMode            string
+	maxCellLength       int
+	skipEmptyDefinition bool
+	dedupe              bool
+	tags                string // space-separated Anki tags of every note
+	overrides           overrides
+}
+
+// entrySet is what readEntries read from the inputs of a run.
+type entrySet struct {
+	entries         []lingo.Entry
+	previousFailure map[int]string // entry Seq -> reason from -retry-failures
+	inputWords      map[string]int // input -> entries read from it
+}
+
+// readEntries reads the words of every input, in order, skipping rows that
+// have no word, duplicates with opts.dedupe, and the rows opts.maxCellLength
+// and opts.skipEmptyDefinition leave out.
+func readEntries(inputs []string, opts entryOptions, logs *lingo.Logger) (entrySet, error) {
+	r := newEntryReader(opts, logs)
+	for _, input := range inputs {
+		// "-" reads tab-separated word/definition lines from stdin, and text
+		// files are read as delimited word/definition rows.
+		var rows []inputRow
+		var err error
+		if opts.retry {
+			rows, err = readFailures(input)
+		} else {
+			rows, err = readInputRows(input, opts.charset, opts.stream)
+		}
+		if err != nil {
+			return entrySet{}, fmt.Errorf("Failed to read %s: %w", input, err)
+		}
+		for _, row := range rows {
+			if e, ok := r.entry(input, row); ok {
+				r.set.entries = append(r.set.entries, e)
+			}
+		}
+	}
+	r.logSkipped()
+	return r.set, nil
+}
+
+// entryReader turns input rows into entries the way readEntries does, one
+// row at a time. Its set collects everything but the entries themselves.
+type entryReader struct {
+	opts              entryOptions
+	definitionColumns []int
+	logs              *lingo.Logger
+	set               entrySet
+	read              int // entries read, the Seq of the next one
+	seen              map[string]bool
+	duplicates        int
+	emptyDefinitions  int
+	longWords         int
+}
+
+func newEntryReader(opts entryOptions, logs *lingo.Logger) *entryReader {
+	r := &entryReader{
+		opts:              opts,
+		definitionColumns: opts.definitionColumns,
+		logs:              logs,
+		set:               entrySet{previousFailure: map[int]string{}, inputWords: map[string]int{}},
+		seen:              map[string]bool{},
+	}
+	if r.definitionColumns == nil {
+		r.definitionColumns = []int{1}
+	}
+	return r
+}
+
+// entry returns the entry of a row of input, or false for a row left out.
+func (r *entryReader) entry(input string, row inputRow) (lingo.Entry, bool) {
+	opts := r.opts
+	// Skip rows that do not have at least two cells or have no word; with
+	// -def-cols a row uses whichever definition cells it has.
+	if len(row.cells) < 1 || strings.TrimSpace(row.cells[0]) == "" || (opts.definitionColumns == nil && len(row.cells) < 2) {
+		return lingo.Entry{}, false
+	}
+
+	// Read the English word and definition. Without -def-cols a stdin line
+	// keeps everything after the first tab, tabs included.
+	word := normalizeCase(strings.TrimSpace(row.cells[0]), opts.caseMode)
+	definition := joinCells(row.cells, r.definitionColumns, opts.defSeparator)
+	if input == "-" && opts.definitionColumns == nil {
+		definition = strings.TrimSpace(strings.Join(row.cells[1:], "\t"))
+	}
+	// A cell this long is almost certainly corrupt; it must not reach the
+	// APIs. The word itself is left out of the log line.
+	if opts.maxCellLength > 0 {
+		if n := utf8.RuneCountInString(word); n > opts.maxCellLength {
+			r.logs.For("word_too_long", "").Errorf("Row %d of %s: the word has %d characters, more than -max-cell-length %d, skipping it", row.number, input, n, opts.maxCellLength)
+			r.longWords++
+			return lingo.Entry{}, false
+		}
+		if n := utf8.RuneCountInString(definition); n > opts.maxCellLength {
+			definition = lingo.TruncateText(definition, opts.maxCellLength)
+			r.logs.For("definition_truncated", word).Warnf("Row %d of %s: the definition of %s has %d characters, truncated to -max-cell-length %d", row.number, input, word, n, opts.maxCellLength)
+		}
+	}
+	if opts.skipEmptyDefinition && strings.TrimSpace(definition) == "" {
+		r.logs.For("empty_definition_skipped", word).Verbosef("Skipping %s in row %d of %s, its definition is empty", word, row.number, input)
+		r.emptyDefinitions++
+		return lingo.Entry{}, false
+	}
+	term := word
+	if opts.caseMode != "preserve" {
+		// Look up one consistent form however the card shows it.
+		term = strings.ToLower(word)
+	}
+	if opts.dedupe {
+		// Duplicates are dropped across all inputs, not just within one.
+		key := strings.ToLower(word)
+		if r.seen[key] {
+			r.logs.For("duplicate_skipped", word).Verbosef("Skipping duplicate word %s in row %d of %s", word, row.number, input)
+			r.duplicates++
+			return lingo.Entry{}, false
+		}
+		r.seen[key] = true
+	}
+	e := lingo.Entry{
+		Seq:        r.read,
+		Source:     input,
+		Row:        row.number,
+		Word:       word,
+		Term:       term,
+		Definition: definition,
+		Tags:       opts.tags,
+		Override:   opts.overrides.find(word),
+	}
+	// Only a failures file has a reason in its third column; in other
+	// inputs it is just another cell.
+	if opts.retry && len(row.cells) > 2 {
+		r.set.previousFailure[e.Seq] = row.cells[2]
+	}
+	r.set.inputWords[input]++
+	r.read++
+	return e, true
+}
+
+// logSkipped logs how many rows of each kind were left out.
+func (r *entryReader) logSkipped() {
+	if r.duplicates > 0 {
+		r.logs.Infof("Dropped %d duplicate words", r.duplicates)
+	}
+	if r.longWords > 0 {
+		r.logs.Infof("Skipped %d words longer than -max-cell-length", r.longWords)
+	}
+	if r.emptyDefinitions > 0 {
+		r.logs.Infof("Skipped %d words with an empty definition", r.emptyDefinitions)
+	}
+}
+
+// entryStream reads the entries of a run while they are processed, so with
+// -stream-xlsx the first words of a large workbook are looked up before the
+// rest of it is read.
+type entryStream struct {
+	inputs []string
+	reader *entryReader
+	// prepare readies each entry before it is processed, as the run does
+	// for entries read up front.
+	prepare func(e *lingo.Entry)
+	read    []*lingo.Entry
+	err     error
+}
+
+func newEntryStream(inputs []string, opts entryOptions, logs *lingo.Logger, prepare func(e *lingo.Entry)) *entryStream {
+	return &entryStream{inputs: inputs, reader: newEntryReader(opts, logs), prepare: prepare}
+}
+
+// all yields the entries of the inputs as they are read; it is an
+// iter.Seq for lingo.Processor.Process. A read error stops it and is
+// returned by finish.
+func (s *entryStream) all(yield func(*lingo.Entry) bool) {
+	defer s.reader.logSkipped()
+	for _, input := range s.inputs {
+		more := true
+		err := eachInputRow(input, s.reader.opts.charset, s.reader.opts.stream, func(row inputRow) bool {
+			entry, ok := s.reader.entry(input, row)
+			if !ok {
+				return true
+			}
+			e := &entry
+			s.prepare(e)
+			s.read = append(s.read, e)
+			more = yield(e)
+			return more
+		})
+		if err != nil {
+			s.err = fmt.Errorf("Failed to read %s: %w", input, err)
+			return
+		}
+		if !more {
+			return
+		}
+	}
+}
+
+// finish returns what the stream read once processing is done: the entries
+// pulled from it, as processed, and the rest of the entry set.
+func (s *entryStream) finish() (entrySet, error) {
+	set := s.reader.set
+	set.entries = make([]lingo.Entry, len(s.read))
+	for i, e := range s.read {
+		set.entries[i] = *e
+	}
+	return set, s.err
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yalexaner/simply-lingo/lingo"
+)
+
+func TestReadEntries(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.csv")
+	second := filepath.Join(dir, "second.csv")
+	os.WriteFile(first, []byte("Cat;a small animal\n;no word\nlonglonglonglonglonglong;too long\nDog;\n"), 0644)
+	os.WriteFile(second, []byte("cat;seen already\nhedgehog;a spiny animal\n"), 0644)
+
+	opts := entryOptions{
+		charset:             "auto",
+		caseMode:            "lower",
+		maxCellLength:       20,
+		skipEmptyDefinition: true,
+		dedupe:              true,
+		tags:                "animals",
+	}
+	logs := lingo.NewLogger(lingo.LevelQuiet, io.Discard, io.Discard)
+	set, err := readEntries([]string{first, second}, opts, logs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, e := range set.entries {
+		got = append(got, strings.Join([]string{e.Source, e.Word, e.Term, e.Definition, e.Tags}, "|"))
+	}
+	want := []string{
+		first + "|cat|cat|a small animal|animals",
+		second + "|hedgehog|hedgehog|a spiny animal|animals",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("entries = %q, want %q", got, want)
+	}
+	if set.entries[1].Seq != 1 || set.entries[1].Row != 2 {
+		t.Errorf("hedgehog has Seq %d, Row %d, want 1, 2", set.entries[1].Seq, set.entries[1].Row)
+	}
+	if want := map[string]int{first: 1, second: 1}; !reflect.DeepEqual(set.inputWords, want) {
+		t.Errorf("inputWords = %v, want %v", set.inputWords, want)
+	}
+}
+
+func TestReadEntriesRetry(t *testing.T) {
+	failures := filepath.Join(t.TempDir(), "failures.csv")
+	os.WriteFile(failures, []byte("cat;a small animal;fetching translation: timeout\n"), 0644)
+
+	logs := lingo.NewLogger(lingo.LevelQuiet, io.Discard, io.Discard)
+	set, err := readEntries([]string{failures}, entryOptions{retry: true, caseMode: "preserve"}, logs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set.entries) != 1 || set.entries[0].Definition != "a small animal" {
+		t.Fatalf("entries = %+v, want cat with its definition", set.entries)
+	}
+	if got := set.previousFailure[0]; got != "fetching translation: timeout" {
+		t.Errorf("previousFailure = %q, want the reason of the failures file", got)
+	}
+}
+
+func TestReadEntriesThirdColumn(t *testing.T) {
+	input := filepath.Join(t.TempDir(), "words.csv")
+	os.WriteFile(input, []byte("cat;a small animal;pets\n"), 0644)
+
+	// Outside -retry-failures a third cell is not a failure reason.
+	logs := lingo.NewLogger(lingo.LevelQuiet, io.Discard, io.Discard)
+	set, err := readEntries([]string{input}, entryOptions{charset: "auto", caseMode: "preserve"}, logs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set.previousFailure) != 0 {
+		t.Errorf("previousFailure = %q, want none", set.previousFailure)
+	}
+}
+
+func TestEntryStream(t *testing.T) {
+	logs := lingo.NewLogger(lingo.LevelQuiet, io.Discard, io.Discard)
+	var prepared []string
+	stream := newEntryStream([]string{"testdata/merged.xlsx"}, entryOptions{stream: true, caseMode: "preserve"}, logs, func(e *lingo.Entry) {
+		prepared = append(prepared, e.Word)
+	})
+	for e := range stream.all {
+		e.Translation = "бежать"
+		break
+	}
+
+	// Reading stops with the consumer, so the rest of the sheet is never
+	// read, and the entries come back as processed.
+	set, err := stream.finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set.entries) != 1 || set.entries[0].Word != "run" || set.entries[0].Translation != "бежать" {
+		t.Errorf("entries = %+v, want the processed run", set.entries)
+	}
+	if want := []string{"run"}; !reflect.DeepEqual(prepared, want) {
+		t.Errorf("prepared %q, want %q", prepared, want)
+	}
+	if got := set.inputWords["testdata/merged.xlsx"]; got != 1 {
+		t.Errorf("inputWords = %d, want 1", got)
+	}
+}
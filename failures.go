@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yalexaner/simply-lingo/lingo"
+)
+
+// failureLog records words that didn't make it into the output, one
+// word;definition;reason row per word, so they can be reviewed or retried
+// with -retry-failures.
+type failureLog struct {
+	path string
+	file *os.File
+	csv  *csv.Writer
+}
+
+// createFailureLog starts a failures file at path. It is written next to
+// path and only replaces it on Close, so the previous file, which may be the
+// input of -retry-failures, survives a crash. With resume, the temporary
+// files of crashed runs are removed, after carrying over their rows for
+// which keep, if set, reports true: the words -resume doesn't run again.
+func createFailureLog(path string, resume bool, keep func(word, definition string) bool) (*failureLog, error) {
+	var stale []string
+	if resume {
+		var err error
+		if stale, err = staleFailureLogs(path); err != nil {
+			return nil, err
+		}
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	w := csv.NewWriter(f)
+	w.Comma = ';'
+	l := &failureLog{path: path, file: f, csv: w}
+
+	for _, name := range stale {
+		rows, err := readFailures(name)
+		if err != nil {
+			l.discard()
+			return nil, fmt.Errorf("reading %s: %w", name, err)
+		}
+		for _, row := range rows {
+			word, definition := row.cells[0], ""
+			if len(row.cells) > 1 {
+				definition = row.cells[1]
+			}
+			if keep != nil && keep(word, definition) {
+				w.Write(row.cells)
+			}
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		l.discard()
+		return nil, err
+	}
+	// Once carried over, a crash leaves the rows in this run's file.
+	for _, name := range stale {
+		os.Remove(name)
+	}
+	return l, nil
+}
+
+// staleFailureLogs lists the temporary files runs writing the failures file
+// at path left behind when they crashed.
+func staleFailureLogs(path string) ([]string, error) {
+	dir, base := filepath.Split(path)
+	entries, err := os.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return nil, err
+	}
+	var stale []string
+	for _, entry := range entries {
+		if name := entry.Name(); entry.Type().IsRegular() && strings.HasPrefix(name, base+".") && strings.HasSuffix(name, ".tmp") {
+			stale = append(stale, filepath.Join(dir, name))
+		}
+	}
+	return stale, nil
+}
+
+// notRerun returns a keep function for createFailureLog that carries over
+// the failures of the words not in entries, the ones a resumed run doesn't
+// run again.
+func notRerun(entries []lingo.Entry) func(word, definition string) bool {
+	rerun := map[[2]string]bool{}
+	for _, e := range entries {
+		rerun[[2]string{e.Word, e.Definition}] = true
+	}
+	return func(word, definition string) bool {
+		return !rerun[[2]string{word, definition}]
+	}
+}
+
+// readFailures reads the rows of a failures file written by an earlier run.
+func readFailures(path string) ([]inputRow, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readDelimitedRows(f, ';')
+}
+
+// record adds e to the log. It is a no-op on a nil log so callers don't need
+// to check whether a failures file was requested. Rows are flushed right
+// away, so they survive a crash for -resume to carry over.
+func (l *failureLog) record(e *lingo.Entry, reason string) error {
+	if l == nil {
+		return nil
+	}
+	l.csv.Write([]string{e.Word, e.Definition, reason})
+	l.csv.Flush()
+	return l.csv.Error()
+}
+
+// discard removes the log without replacing the previous file.
+func (l *failureLog) discard() {
+	l.file.Close()
+	os.Remove(l.file.Name())
+}
+
+func (l *failureLog) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.csv.Flush()
+	if err := l.csv.Error(); err != nil {
+		l.discard()
+		return err
+	}
+	if err := l.file.Close(); err != nil {
+		os.Remove(l.file.Name())
+		return err
+	}
+	if err := os.Chmod(l.file.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(l.file.Name(), l.path)
+}
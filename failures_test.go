@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/yalexaner/simply-lingo/lingo"
+)
+
+func TestFailureLogResume(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "failures.csv")
+	// A crashed run got as far as cat and dog; -resume runs dog again.
+	stale := filepath.Join(dir, "failures.csv.123.tmp")
+	if err := os.WriteFile(stale, []byte("cat;a small animal;fetching translation: timeout\ndog;a pet;generating audio: busy\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	log, err := createFailureLog(path, true, func(word, definition string) bool { return word != "dog" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := log.record(&lingo.Entry{Word: "fish", Definition: "swims"}, "no translation found"); err != nil {
+		t.Fatal(err)
+	}
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"cat;a small animal;fetching translation: timeout", "fish;swims;no translation found"}
+	if got := readLines(t, path); !slices.Equal(got, want) {
+		t.Errorf("failures file = %q, want %q", got, want)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("%s of the crashed run is still there", stale)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(matches) > 0 {
+		t.Errorf("temporary files left: %q", matches)
+	}
+}
+
+func TestFailureLogWithoutResume(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "failures.csv")
+	// Without -resume the file may belong to a run still going.
+	other := filepath.Join(dir, "failures.csv.456.tmp")
+	if err := os.WriteFile(other, []byte("cat;a small animal;timeout\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	log, err := createFailureLog(path, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(path); err != nil || len(data) != 0 {
+		t.Errorf("failures file = %q, %v, want it empty", data, err)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("another run's file was removed: %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/yalexaner/simply-lingo/lingo"
+)
+
+// flagGroups orders the flags in the usage message. Flags missing from every
+// group are listed under "Other".
+var flagGroups = []struct {
+	title string
+	names []string
+}{
+	{"Input", []string{"def-cols", "def-separator", "input-charset", "stream-xlsx", "overrides", "normalize-case", "max-cell-length", "skip-empty-definition", "dedupe", "word-transform", "limit"}},
+	{"Translation", []string{"dict-provider", "lang", "yandex-url", "yandex-flags", "pos", "lang-detect", "lang-candidates", "strict", "expand-translations", "join-translations", "translations", "top-only", "min-frequency", "synonyms", "field-separator", "translate-definition", "mt-url", "mt-cache"}},
+	{"Audio", []string{"tts-provider", "voice", "preview", "language-voices", "elevenlabs-url", "tts-header", "audio-format", "audio-bitrate", "audio-sample-rate", "audio-dir", "media-dir", "ascii-filenames", "hash-filenames", "audio-naming-template", "speak-template", "speak-example", "max-chars", "skip-long", "audio-cache", "shared-audio", "only-missing-audio", "verify-audio", "price-per-1000"}},
+	{"Output", []string{"format", "out", "columns", "quote", "deck", "tags", "header", "include-index", "with-transcription", "reverse", "explode-examples", "max-examples", "append", "flush-every", "resume", "checkpoint", "failures", "retry-failures", "bundle", "verify", "postprocess", "postprocess-errors"}},
+	{"Execution", []string{"secrets-file", "estimate", "timeout", "deadline", "breaker-failures", "breaker-cooldown", "translate-workers", "audio-workers", "two-pass", "pass-file"}},
+	{"Logging", []string{"ui-lang", "log-level", "log-format", "log-file", "cpuprofile", "memprofile"}},
+}
+
+// headerFlag collects repeated "Key: Value" flags into an http.Header.
+type headerFlag http.Header
+
+func (h headerFlag) String() string {
+	var pairs []string
+	for key, values := range h {
+		for _, value := range values {
+			pairs = append(pairs, key+": "+value)
+		}
+	}
+	return strings.Join(pairs, ", ")
+}
+
+func (h headerFlag) Set(s string) error {
+	key, value, ok := strings.Cut(s, ":")
+	key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+	if !ok || key == "" || strings.ContainsAny(key, " \t") {
+		return fmt.Errorf("want \"Key: Value\", got %q", s)
+	}
+	if http.CanonicalHeaderKey(key) == "Content-Type" {
+		return fmt.Errorf("Content-Type cannot be overridden")
+	}
+	http.Header(h).Add(key, value)
+	return nil
+}
+
+// printUsage is the flag.Usage of the command: the invocation forms followed
+// by the flags in their groups.
+func printUsage() {
+	w := flag.CommandLine.Output()
+	fmt.Fprintln(w, "Usage: go run main.go [flags] <excel_or_csv_file... | ->")
+	fmt.Fprintln(w, "       go run main.go [flags] -only-missing-audio")
+	fmt.Fprintln(w, "       go run main.go [flags] -verify")
+	fmt.Fprintln(w, "       go run main.go [flags] -preview \"phrase\"")
+
+	listed := map[string]bool{}
+	printGroup := func(title string, flags []*flag.Flag) {
+		if len(flags) == 0 {
+			return
+		}
+		fmt.Fprintf(w, "\n%s:\n", title)
+		for _, f := range flags {
+			name, usage := flag.UnquoteUsage(f)
+			line := "  -" + f.Name
+			if name != "" {
+				line += " " + name
+			}
+			line += "\n    \t" + strings.ReplaceAll(usage, "\n", "\n    \t")
+			if f.DefValue != "" && f.DefValue != "false" && f.DefValue != "0" {
+				if _, isString := f.Value.(flag.Getter).Get().(string); isString {
+					line += fmt.Sprintf(" (default %q)", f.DefValue)
+				} else {
+					line += fmt.Sprintf(" (default %v)", f.DefValue)
+				}
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+	for _, group := range flagGroups {
+		var flags []*flag.Flag
+		for _, name := range group.names {
+			if f := flag.Lookup(name); f != nil {
+				flags = append(flags, f)
+				listed[name] = true
+			}
+		}
+		printGroup(group.title, flags)
+	}
+	var other []*flag.Flag
+	flag.VisitAll(func(f *flag.Flag) {
+		if !listed[f.Name] {
+			other = append(other, f)
+		}
+	})
+	printGroup("Other", other)
+}
+
+// validateFlags rejects flag combinations that make no sense together, so a
+// run never starts with options it would silently ignore.
+func validateFlags() error {
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	value := func(name string) string { return flag.Lookup(name).Value.String() }
+	enabled := func(name string) bool { return value(name) == "true" }
+	number := func(name string) float64 {
+		n, _ := strconv.ParseFloat(value(name), 64)
+		return n
+	}
+
+	var errs []error
+	check := func(bad bool, format string, args ...any) {
+		if bad {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	if set["preview"] {
+		check(flag.NArg() > 0, "-preview synthesizes only its phrase and takes no input file")
+		check(strings.TrimSpace(value("preview")) == "", "-preview needs a phrase to synthesize")
+		for _, name := range []string{"only-missing-audio", "verify", "retry-failures", "estimate", "resume", "two-pass"} {
+			check(set[name], "-%s cannot be combined with -preview, which only synthesizes its phrase", name)
+		}
+	} else if enabled("verify") {
+		check(flag.NArg() > 0, "-verify checks the existing output file and takes no input file")
+		for _, name := range []string{"only-missing-audio", "retry-failures", "estimate", "resume", "append"} {
+			check(set[name], "-%s cannot be combined with -verify, which only checks the existing output", name)
+		}
+	} else if enabled("only-missing-audio") {
+		check(flag.NArg() > 0, "-only-missing-audio reads the existing output file and takes no input file")
+		for _, name := range []string{"append", "two-pass", "expand-translations", "explode-examples", "limit", "dedupe", "skip-empty-definition", "word-transform", "lang-detect", "overrides", "stream-xlsx", "bundle", "strict", "failures", "retry-failures", "resume", "estimate", "translate-definition", "postprocess"} {
+			check(set[name], "-%s has no effect with -only-missing-audio, which does not write output", name)
+		}
+	} else if set["retry-failures"] {
+		check(flag.NArg() > 0, "-retry-failures reads its words from the failures file and takes no input file")
+		for _, name := range []string{"failures", "resume", "append", "def-cols"} {
+			check(set[name], "-%s cannot be combined with -retry-failures, which appends to the output and rewrites the failures file itself", name)
+		}
+	} else {
+		check(flag.NArg() < 1, "missing input file")
+		check(flag.NArg() > 1 && slices.Contains(flag.Args(), "-"), "stdin (-) cannot be combined with other inputs")
+	}
+
+	check(set["translations"] && !enabled("expand-translations") && !enabled("join-translations"), "-translations only applies with -expand-translations or -join-translations")
+	check((enabled("expand-translations") || enabled("join-translations")) && number("translations") < 2, "-expand-translations and -join-translations need -translations of at least 2")
+	check(enabled("expand-translations") && enabled("join-translations"), "-expand-translations and -join-translations cannot be combined")
+	check((set["top-only"] || set["min-frequency"]) && !enabled("expand-translations") && !enabled("join-translations"), "-top-only and -min-frequency only apply with -expand-translations or -join-translations")
+	check(number("min-frequency") < 0 || number("min-frequency") > 10, "-min-frequency must be between 0 and 10")
+	check(set["field-separator"] && !enabled("join-translations") && !enabled("synonyms"), "-field-separator only applies with -join-translations or -synonyms")
+	check(set["max-examples"] && !enabled("explode-examples"), "-max-examples only applies with -explode-examples")
+	check(number("max-examples") < 1, "-max-examples must be at least 1")
+	check(!regexp.MustCompile(`^[a-z]{2,3}-[a-z]{2,3}$`).MatchString(value("lang")), "-lang must be a source-target pair such as en-ru")
+	check(enabled("hash-filenames") && enabled("ascii-filenames"), "-ascii-filenames has no effect with -hash-filenames, whose names are always ASCII")
+	if set["audio-naming-template"] {
+		_, err := lingo.ParseAudioNameTemplate(value("audio-naming-template"), "")
+		check(err != nil, "invalid -audio-naming-template: %v", err)
+		check(enabled("hash-filenames"), "-hash-filenames cannot be combined with -audio-naming-template, which names files by {hash} itself")
+		check(set["media-dir"] && strings.Contains(value("audio-naming-template"), "/"), "-audio-naming-template cannot make subdirectories with -media-dir, since Anki's collection.media folder is flat")
+	}
+	check(set["def-separator"] && !set["def-cols"], "-def-separator only applies with -def-cols")
+	check(set["lang-candidates"] && !enabled("lang-detect"), "-lang-candidates only applies with -lang-detect")
+	check(set["pass-file"] && !enabled("two-pass"), "-pass-file only applies with -two-pass")
+	check(enabled("two-pass") && (set["translate-workers"] || set["audio-workers"]), "-two-pass runs sequentially and does not use -translate-workers or -audio-workers")
+	check(number("translate-workers") < 1 || number("audio-workers") < 1, "-translate-workers and -audio-workers must be at least 1")
+	check(value("tts-provider") != "elevenlabs" && (set["voice"] || set["language-voices"] || set["audio-format"] || set["elevenlabs-url"] || set["tts-header"]), "-voice, -language-voices, -audio-format, -elevenlabs-url and -tts-header only apply with -tts-provider elevenlabs")
+	check(number("audio-sample-rate") < 0, "-audio-sample-rate must not be negative")
+	check(number("max-chars") < 0, "-max-chars must not be negative")
+	check(number("max-cell-length") < 0, "-max-cell-length must not be negative")
+	check(enabled("resume") && number("flush-every") == 0, "-resume needs checkpoints, which are written on every -flush-every")
+	check(enabled("resume") && slices.Contains(flag.Args(), "-"), "-resume cannot continue reading from stdin")
+	check(!slices.Contains([]string{"lower", "title", "preserve"}, value("normalize-case")), "-normalize-case must be lower, title or preserve")
+	check(!slices.Contains([]string{"auto", "utf-8", "utf8", "windows-1251", "cp1251"}, strings.ToLower(value("input-charset"))), "-input-charset must be auto, utf-8 or windows-1251")
+	check(strings.HasPrefix(value("deadline"), "-"), "-deadline must not be negative")
+	check(!slices.Contains([]string{"text", "json"}, value("log-format")), "-log-format must be text or json")
+	if value("out") == "-" {
+		for _, name := range []string{"verify", "only-missing-audio", "retry-failures", "append", "resume", "bundle"} {
+			check(set[name], "-%s needs an output file and cannot be combined with -out -", name)
+		}
+	}
+	check(!slices.Contains([]string{"minimal", "all"}, value("quote")), "-quote must be minimal or all")
+	if value("format") == "jsonl" {
+		for _, name := range []string{"quote", "deck", "header"} {
+			check(set[name], "-%s only applies to the delimited -format csv and tsv", name)
+		}
+	}
+	check(!slices.Contains([]string{"fail", "skip"}, value("postprocess-errors")), "-postprocess-errors must be fail or skip")
+	check(set["postprocess-errors"] && value("postprocess") == "", "-postprocess-errors only applies with -postprocess")
+	check(enabled("translate-definition") && enabled("explode-examples"), "-translate-definition cannot be combined with -explode-examples, whose rows show dictionary examples instead of the definition")
+	check((set["mt-url"] || set["mt-cache"]) && !enabled("translate-definition"), "-mt-url and -mt-cache only apply with -translate-definition")
+	check(!slices.Contains(lingo.UILanguages(), value("ui-lang")), "-ui-lang must be %s", strings.Join(lingo.UILanguages(), " or "))
+	if set["columns"] {
+		columns, err := parseColumnSpec(value("columns"))
+		check(err != nil, "invalid -columns: %v", err)
+		for _, name := range []string{"include-index", "reverse", "with-transcription", "synonyms"} {
+			check(set[name], "-%s has no effect with -columns, which lists every column itself", name)
+		}
+		check(slices.Contains(columns, columnExampleSound) && !enabled("speak-example"), "the example_sound column needs -speak-example")
+		check(slices.Contains(columns, columnDefinitionTranslation) && !enabled("translate-definition"), "the definition_translation column needs -translate-definition")
+		check(enabled("translate-definition") && err == nil && !slices.Contains(columns, columnDefinitionTranslation), "-translate-definition needs the definition_translation column in -columns")
+		check(enabled("speak-example") && err == nil && !slices.Contains(columns, columnExampleSound), "-speak-example needs the example_sound column in -columns")
+		check(enabled("only-missing-audio") && err == nil && (!slices.Contains(columns, columnWord) || !slices.Contains(columns, columnSound)), "-only-missing-audio needs the word and sound columns in -columns")
+	}
+	check(number("yandex-flags") < 0 || number("yandex-flags") > 15, "-yandex-flags must be a sum of the bits 1, 2, 4 and 8")
+	check(set["pos"] && int(number("yandex-flags"))&lingo.YandexShortPos != 0, "-pos names full parts of speech, which -yandex-flags 2 abbreviates")
+	check(number("breaker-failures") < 0, "-breaker-failures must not be negative")
+	check(set["breaker-cooldown"] && !set["breaker-failures"], "-breaker-cooldown only applies with -breaker-failures")
+	check(strings.HasPrefix(value("breaker-cooldown"), "-"), "-breaker-cooldown must not be negative")
+	check(number("limit") < 0, "-limit must not be negative")
+	check(number("flush-every") < 0, "-flush-every must not be negative")
+	check(number("price-per-1000") < 0, "-price-per-1000 must not be negative")
+	return errors.Join(errs...)
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/tealeg/xlsx"
+)
+
+// inputRow is a row of raw cell values read from the input.
+type inputRow struct {
+	number int // 1-based row or line number in the input
+	cells  []string
+}
+
+// parseColumns parses a comma-separated list of columns, each given as a
+// spreadsheet letter (A, B, ..., AA) or a 1-based number, into 0-based
+// indices.
+func parseColumns(spec string) ([]int, error) {
+	var columns []int
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if n, err := strconv.Atoi(name); err == nil {
+			if n < 1 {
+				return nil, fmt.Errorf("column %s: numbers start at 1", name)
+			}
+			columns = append(columns, n-1)
+			continue
+		}
+		index := 0
+		for _, r := range name {
+			if r < 'A' || r > 'Z' {
+				return nil, fmt.Errorf("column %q is neither a letter nor a number", name)
+			}
+			index = index*26 + int(r-'A'+1)
+		}
+		columns = append(columns, index-1)
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no columns given")
+	}
+	return columns, nil
+}
+
+// joinCells joins the non-empty cells at columns with sep, skipping columns
+// the row doesn't have.
+func joinCells(cells []string, columns []int, sep string) string {
+	var parts []string
+	for _, c := range columns {
+		if c < len(cells) {
+			if cell := strings.TrimSpace(cells[c]); cell != "" {
+				parts = append(parts, cell)
+			}
+		}
+	}
+	return strings.Join(parts, sep)
+}
+
+// expandInputs expands glob patterns among the input arguments, so a quoted
+// "lessons/*.xlsx" works the same on every shell. A pattern matching nothing
+// is an error; "-" (stdin) passes through unchanged.
+func expandInputs(args []string) ([]string, error) {
+	var inputs []string
+	for _, arg := range args {
+		if arg == "-" || !strings.ContainsAny(arg, "*?[") {
+			inputs = append(inputs, arg)
+			continue
+		}
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", arg, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %s", arg)
+		}
+		inputs = append(inputs, matches...)
+	}
+	return inputs, nil
+}
+
+// readInputRows reads the rows of an input: tab-separated lines from stdin
+// for "-", delimited text for .csv, .tsv and .txt files, otherwise an Excel
+// workbook, read with readXLSXStream when stream is set. Text is decoded from
+// charset (see decodeInput) first.
+func readInputRows(input, charset string, stream bool) ([]inputRow, error) {
+	if input == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		text, err := decodeInput(data, charset)
+		if err != nil {
+			return nil, err
+		}
+		return readTSVRows(strings.NewReader(text))
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(input)); ext {
+	case ".csv", ".tsv", ".txt":
+		data, err := os.ReadFile(input)
+		if err != nil {
+			return nil, err
+		}
+		text, err := decodeInput(data, charset)
+		if err != nil {
+			return nil, err
+		}
+		comma := '\t'
+		if ext == ".csv" {
+			comma = sniffDelimiter(text)
+		}
+		return readDelimitedRows(strings.NewReader(text), comma)
+	}
+	if stream {
+		return readXLSXStream(input)
+	}
+	return readXLSXRows(input)
+}
+
+// eachInputRow passes the rows of an input to yield until it returns false.
+// With stream, Excel workbooks are passed on row by row as they are read
+// (see streamXLSXRows); other inputs are read whole first.
+func eachInputRow(input, charset string, stream bool, yield func(inputRow) bool) error {
+	if stream && isWorkbook(input) {
+		return streamXLSXRows(input, yield)
+	}
+	rows, err := readInputRows(input, charset, stream)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if !yield(row) {
+			break
+		}
+	}
+	return nil
+}
+
+// isWorkbook reports whether readInputRows reads input as an Excel workbook.
+func isWorkbook(input string) bool {
+	switch strings.ToLower(filepath.Ext(input)) {
+	case ".csv", ".tsv", ".txt":
+		return false
+	}
+	return input != "-"
+}
+
+// sniffDelimiter guesses the delimiter of CSV text from its first line:
+// whichever of semicolon, comma and tab occurs most often, preferring the
+// semicolon Excel uses in many locales.
+func sniffDelimiter(text string) rune {
+	line, _, _ := strings.Cut(text, "\n")
+	best, bestCount := ';', strings.Count(line, ";")
+	for _, comma := range []rune{',', '\t'} {
+		if n := strings.Count(line, string(comma)); n > bestCount {
+			best, bestCount = comma, n
+		}
+	}
+	return best
+}
+
+// readDelimitedRows reads word/definition rows of delimited text, skipping
+// blank lines.
+func readDelimitedRows(r io.Reader, comma rune) ([]inputRow, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	var rows []inputRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if isBlankRow(record) {
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+		rows = append(rows, inputRow{number: line, cells: record})
+	}
+}
+
+// readXLSXRows reads the rows of the first sheet of an Excel workbook. Cells
+// covered by a merged range take the value of the range, empty rows are
+// skipped, and so are headings: rows whose word and definition are a single
+// merged cell.
+func readXLSXRows(path string) ([]inputRow, error) {
+	xlFile, err := xlsx.OpenFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(xlFile.Sheets) == 0 {
+		return nil, fmt.Errorf("no sheets found in the Excel file")
+	}
+	sheet := xlFile.Sheets[0]
+
+	grid := make([][]string, len(sheet.Rows))
+	heading := make([]bool, len(sheet.Rows))
+	for i, row := range sheet.Rows {
+		if row == nil {
+			continue
+		}
+		for j, cell := range row.Cells {
+			if cell == nil {
+				continue
+			}
+			value := cell.String()
+			// Only the top-left cell of a merged range holds the value.
+			for di := 0; di <= cell.VMerge && i+di < len(grid); di++ {
+				for dj := 0; dj <= cell.HMerge; dj++ {
+					setCell(&grid[i+di], j+dj, value)
+					if j+dj == 0 && cell.HMerge > 0 {
+						heading[i+di] = true
+					}
+				}
+			}
+		}
+	}
+
+	rows := make([]inputRow, 0, len(grid))
+	for i, cells := range grid {
+		if heading[i] || isBlankRow(cells) {
+			continue
+		}
+		rows = append(rows, inputRow{number: i + 1, cells: cells})
+	}
+	return rows, nil
+}
+
+// setCell stores value at column j of row unless a merged range has already
+// filled it, growing the row as needed.
+func setCell(row *[]string, j int, value string) {
+	for len(*row) <= j {
+		*row = append(*row, "")
+	}
+	if (*row)[j] == "" {
+		(*row)[j] = value
+	}
+}
+
+// isBlankRow reports whether every cell of a row is empty or whitespace.
+func isBlankRow(cells []string) bool {
+	for _, cell := range cells {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// readTSVRows reads newline-delimited word<tab>definition pairs. A line
+// without a tab is a word with an empty definition; blank lines are skipped.
+func readTSVRows(r io.Reader) ([]inputRow, error) {
+	var rows []inputRow
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		cells := strings.Split(text, "\t")
+		if len(cells) == 1 {
+			// A bare word is a word with an empty definition.
+			cells = append(cells, "")
+		}
+		rows = append(rows, inputRow{number: line, cells: cells})
+	}
+	return rows, scanner.Err()
+}
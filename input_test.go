@@ -0,0 +1,60 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReadInputRowsXLSX(t *testing.T) {
+	// merged.xlsx has a "Vocabulary" heading merged over A1:B1, an empty
+	// second row, and the definition of run merged down over sprint's row.
+	want := []inputRow{
+		{number: 3, cells: []string{"run", "to move fast"}},
+		{number: 4, cells: []string{"sprint", "to move fast"}},
+		{number: 6, cells: []string{"cat", "a small animal"}},
+	}
+	for _, stream := range []bool{false, true} {
+		rows, err := readInputRows("testdata/merged.xlsx", "auto", stream)
+		if err != nil {
+			t.Fatalf("stream %v: %v", stream, err)
+		}
+		if !reflect.DeepEqual(rows, want) {
+			t.Errorf("stream %v: rows = %+v, want %+v", stream, rows, want)
+		}
+	}
+}
+
+func TestReadInputRowsCharset(t *testing.T) {
+	want := []inputRow{
+		{number: 1, cells: []string{"cat", "кошка, домашнее животное"}},
+		{number: 2, cells: []string{"dog", "собака"}},
+		{number: 3, cells: []string{"hedgehog", "ёж"}},
+	}
+	tests := []struct {
+		input   string
+		charset string
+		wantErr bool
+	}{
+		{input: "testdata/words-utf8-bom.csv", charset: "auto"},
+		{input: "testdata/words-utf8-bom.csv", charset: "utf-8"},
+		{input: "testdata/words-cp1251.csv", charset: "auto"},
+		{input: "testdata/words-cp1251.csv", charset: "windows-1251"},
+		{input: "testdata/words-cp1251.csv", charset: "utf-8", wantErr: true},
+	}
+	for _, tt := range tests {
+		rows, err := readInputRows(tt.input, tt.charset, false)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s as %s: want an error", tt.input, tt.charset)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s as %s: %v", tt.input, tt.charset, err)
+			continue
+		}
+		if !reflect.DeepEqual(rows, want) {
+			t.Errorf("%s as %s: rows = %q, want %q", tt.input, tt.charset, rows, want)
+		}
+	}
+}
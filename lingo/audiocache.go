@@ -0,0 +1,124 @@
+package lingo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// audioCacheIndex is the name of the index file inside the cache directory.
+const audioCacheIndex = "index.json"
+
+// CachingTTS reuses audio from earlier identical synthesis requests, keyed by
+// a hash of the text, language and the provider's fingerprint rather than by
+// the word that asked for it. It is safe for concurrent use; concurrent
+// requests for the same key wait for a single synthesis.
+type CachingTTS struct {
+	TTSProvider
+	dir  string
+	logs *Logger
+
+	mu       sync.Mutex
+	index    map[string]string // hash -> file name in dir
+	inflight map[string]*cachedSynthesis
+}
+
+// cachedSynthesis is a synthesis in progress that other callers can wait for.
+type cachedSynthesis struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// NewCachingTTS opens the audio cache in dir, creating it if needed.
+func NewCachingTTS(tts TTSProvider, dir string, logs *Logger) (*CachingTTS, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	index := map[string]string{}
+	data, err := os.ReadFile(filepath.Join(dir, audioCacheIndex))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &index); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", audioCacheIndex, err)
+		}
+	}
+	return &CachingTTS{
+		TTSProvider: tts,
+		dir:         dir,
+		logs:        logs,
+		index:       index,
+		inflight:    map[string]*cachedSynthesis{},
+	}, nil
+}
+
+// synthesisKey identifies the audio tts makes of text in lang, by a hash of
+// both and the provider's fingerprint.
+func synthesisKey(tts TTSProvider, text, lang string) string {
+	sum := sha256.Sum256([]byte(tts.Fingerprint() + "\x00" + lang + "\x00" + text))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *CachingTTS) Synthesize(text, lang string) ([]byte, error) {
+	key := synthesisKey(c, text, lang)
+
+	c.mu.Lock()
+	if name, ok := c.index[key]; ok {
+		c.mu.Unlock()
+		data, err := os.ReadFile(filepath.Join(c.dir, name))
+		if err == nil {
+			c.logs.For("audio_cache_hit", "").Verbosef("Reusing cached audio for %q", text)
+			return data, nil
+		}
+		c.logs.Warnf("reading cached audio %s: %v", name, err)
+		c.mu.Lock()
+		delete(c.index, key)
+	}
+	if call, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		<-call.done
+		return call.data, call.err
+	}
+	call := &cachedSynthesis{done: make(chan struct{})}
+	c.inflight[key] = call
+	c.mu.Unlock()
+
+	call.data, call.err = c.TTSProvider.Synthesize(text, lang)
+	if call.err == nil {
+		c.store(key, call.data)
+	}
+
+	c.mu.Lock()
+	delete(c.inflight, key)
+	c.mu.Unlock()
+	close(call.done)
+	return call.data, call.err
+}
+
+// store saves data under key and rewrites the index. Failures only cost a
+// cache miss later, so they are logged rather than returned.
+func (c *CachingTTS) store(key string, data []byte) {
+	name := key + "." + c.Extension()
+	if err := WriteFileAtomic(filepath.Join(c.dir, name), data); err != nil {
+		c.logs.Warnf("caching audio: %v", err)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.index[key] = name
+	index, err := json.MarshalIndent(c.index, "", "  ")
+	if err == nil {
+		err = WriteFileAtomic(filepath.Join(c.dir, audioCacheIndex), index)
+	}
+	if err != nil {
+		c.logs.Warnf("saving audio cache index: %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package lingo
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// breakerState is the state of a Breaker.
+type breakerState int
+
+const (
+	breakerClosed   breakerState = iota // requests pass
+	breakerOpen                         // requests wait for the cooldown to end
+	breakerHalfOpen                     // one probe request is in flight
+)
+
+// Breaker is a circuit breaker shared by all requests to one API. After a
+// number of consecutive failures it opens and holds every request back for a
+// cooldown, then lets a single probe through: its success closes the breaker
+// again, its failure starts another cooldown. Requests wait rather than fail
+// while the breaker is open, so a temporary outage delays the run instead of
+// failing every word; once ctx is done they fail with its error instead.
+type Breaker struct {
+	ctx       context.Context
+	name      string
+	threshold int
+	cooldown  time.Duration
+	logs      *Logger
+
+	mu       sync.Mutex
+	probed   *sync.Cond // signalled when a probe finishes
+	state    breakerState
+	failures int
+	openedAt time.Time
+}
+
+// NewBreaker returns a breaker for the API called name that opens after
+// threshold consecutive failures and stays open for cooldown. Waiting for
+// the cooldown ends early when ctx is done.
+func NewBreaker(ctx context.Context, name string, threshold int, cooldown time.Duration, logs *Logger) *Breaker {
+	b := &Breaker{ctx: ctx, name: name, threshold: max(threshold, 1), cooldown: cooldown, logs: logs}
+	b.probed = sync.NewCond(&b.mu)
+	return b
+}
+
+// Do runs fn, the request, once the breaker lets it through and records its
+// outcome. It returns the context's error without running fn when the
+// context is done before the breaker lets it through.
+func (b *Breaker) Do(fn func() error) error {
+	if err := b.acquire(); err != nil {
+		return err
+	}
+	err := fn()
+	if errors.Is(err, ErrQuotaExceeded) {
+		// The API answers, it just won't do more for this account; pausing
+		// would only delay the words that don't need it.
+		b.release(nil)
+		return err
+	}
+	b.release(err)
+	return err
+}
+
+func (b *Breaker) acquire() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for {
+		if err := b.ctx.Err(); err != nil {
+			return err
+		}
+		switch b.state {
+		case breakerClosed:
+			return nil
+		case breakerOpen:
+			wait := time.Until(b.openedAt.Add(b.cooldown))
+			if wait <= 0 {
+				b.state = breakerHalfOpen
+				b.logs.For("breaker_half_open", "").Infof("%s cooldown over, sending one request to check it is back", b.name)
+				return nil
+			}
+			b.mu.Unlock()
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-b.ctx.Done():
+				timer.Stop()
+			}
+			b.mu.Lock()
+		case breakerHalfOpen:
+			// The probe's request is aborted along with ctx, so this
+			// doesn't outlast it.
+			b.probed.Wait()
+		}
+	}
+}
+
+func (b *Breaker) release(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		if b.state != breakerClosed {
+			b.logs.For("breaker_closed", "").Infof("%s requests succeed again, resuming", b.name)
+		}
+		b.state, b.failures = breakerClosed, 0
+		b.probed.Broadcast()
+		return
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || (b.state == breakerClosed && b.failures >= b.threshold) {
+		b.state, b.openedAt = breakerOpen, time.Now()
+		b.logs.For("breaker_open", "").Warnf("%s failed %d times in a row, pausing its requests for %s", b.name, b.failures, b.cooldown)
+		b.probed.Broadcast()
+	}
+}
+
+// BreakerDictionary sends the lookups of a DictionaryProvider through a
+// Breaker.
+type BreakerDictionary struct {
+	DictionaryProvider
+	Breaker *Breaker
+}
+
+func (d BreakerDictionary) Lookup(word string) (DictionaryEntry, error) {
+	var entry DictionaryEntry
+	err := d.Breaker.Do(func() (err error) {
+		entry, err = d.DictionaryProvider.Lookup(word)
+		return err
+	})
+	return entry, err
+}
+
+// BreakerTTS sends the requests of a TTSProvider through a Breaker.
+type BreakerTTS struct {
+	TTSProvider
+	Breaker *Breaker
+}
+
+func (t BreakerTTS) Synthesize(text, lang string) ([]byte, error) {
+	var data []byte
+	err := t.Breaker.Do(func() (err error) {
+		data, err = t.TTSProvider.Synthesize(text, lang)
+		return err
+	})
+	return data, err
+}
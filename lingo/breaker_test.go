@@ -0,0 +1,62 @@
+package lingo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestBreakerOpensAndWaitsForContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b := NewBreaker(ctx, "test", 2, time.Hour, NewLogger(LevelQuiet, io.Discard, io.Discard))
+	failed := errors.New("unavailable")
+	for range 2 {
+		if err := b.Do(func() error { return failed }); err != failed {
+			t.Fatalf("Do = %v, want %v", err, failed)
+		}
+	}
+
+	// Open for an hour: the next request waits until the context ends.
+	done := make(chan error)
+	go func() {
+		done <- b.Do(func() error {
+			t.Error("request sent while the breaker is open")
+			return nil
+		})
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("Do returned %v while the breaker is open", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Do = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Do still waiting after the context was cancelled")
+	}
+}
+
+func TestBreakerProbe(t *testing.T) {
+	b := NewBreaker(context.Background(), "test", 1, 10*time.Millisecond, NewLogger(LevelQuiet, io.Discard, io.Discard))
+	b.Do(func() error { return errors.New("unavailable") })
+	start := time.Now()
+	if err := b.Do(func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(start); waited < 10*time.Millisecond {
+		t.Errorf("probe sent after %s, before the cooldown", waited)
+	}
+	// The successful probe closed the breaker again.
+	calls := 0
+	b.Do(func() error { calls++; return nil })
+	if calls != 1 {
+		t.Errorf("request after the probe ran %d times", calls)
+	}
+}
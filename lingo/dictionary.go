@@ -0,0 +1,121 @@
+package lingo
+
+import "slices"
+
+// DictionaryProvider looks words up in a bilingual dictionary.
+type DictionaryProvider interface {
+	// Lookup returns the dictionary entry for word. A word the dictionary
+	// doesn't know yields an entry without senses, not an error.
+	Lookup(word string) (DictionaryEntry, error)
+}
+
+// DictionaryEntry is a provider-independent dictionary lookup result.
+type DictionaryEntry struct {
+	// Senses lists the translations in the order the provider ranks them.
+	Senses []Sense
+	// Transcription is the pronunciation of the word, empty if the provider
+	// has none.
+	Transcription string `json:",omitempty"`
+	// Lang is the detected language of the word, empty when the caller's
+	// source language applies.
+	Lang string `json:",omitempty"`
+}
+
+// Sense is a single translation of a word.
+type Sense struct {
+	Text     string
+	Pos      string
+	Synonyms []string
+	// Examples are usage examples, each followed by its translation.
+	Examples []string
+	// Rank is the place of the translation among those of its part of
+	// speech, 1 for the primary one, or 0 when the provider doesn't rank.
+	Rank int `json:",omitempty"`
+	// Frequency rates how common the translation is, from 1 (rare) to 10
+	// (common), or is 0 when the provider doesn't rate it.
+	Frequency int `json:",omitempty"`
+}
+
+// RankFilter drops low-ranked senses before several translations of a word
+// are written, keeping its cards to the common meanings.
+//
+// Yandex groups the translations of a word into one definition per part of
+// speech, the most common part of speech first, and lists the translations
+// of each definition from the most to the least relevant; Rank is the place
+// in that list. Yandex also rates most translations with a frequency ("fr")
+// from 1 to 10.
+type RankFilter struct {
+	TopOnly      bool // keep only the primary translation of each part of speech
+	MinFrequency int  // drop translations rated below this; unrated ones are kept
+}
+
+// Apply returns entry without the senses f drops.
+func (f RankFilter) Apply(entry DictionaryEntry) DictionaryEntry {
+	var senses []Sense
+	for _, sense := range entry.Senses {
+		if f.TopOnly && sense.Rank > 1 {
+			continue
+		}
+		if sense.Frequency > 0 && sense.Frequency < f.MinFrequency {
+			continue
+		}
+		senses = append(senses, sense)
+	}
+	entry.Senses = senses
+	return entry
+}
+
+// ExampleSentences returns the first max usage examples of entry, taking
+// those of each sense in turn.
+func ExampleSentences(entry DictionaryEntry, max int) []string {
+	var examples []string
+	for _, sense := range entry.Senses {
+		examples = append(examples, sense.Examples...)
+	}
+	if len(examples) > max {
+		examples = examples[:max]
+	}
+	return examples
+}
+
+// firstTranslation returns the text of the first sense of entry. The boolean
+// is false when the dictionary had no translation for the word.
+func firstTranslation(entry DictionaryEntry) (string, bool) {
+	if len(entry.Senses) == 0 {
+		return "", false
+	}
+	return entry.Senses[0].Text, true
+}
+
+// preferredTranslation returns the first sense whose part of speech is one of
+// pos. Without a match it falls back to the first sense and reports matched as
+// false; ok is false when there is no translation at all.
+func preferredTranslation(entry DictionaryEntry, pos []string) (sense Sense, matched, ok bool) {
+	for _, sense := range entry.Senses {
+		if slices.Contains(pos, sense.Pos) {
+			return sense, true, true
+		}
+	}
+	if len(entry.Senses) == 0 {
+		return Sense{}, false, false
+	}
+	return entry.Senses[0], false, true
+}
+
+// DistinctSenses returns up to limit senses of entry with distinct texts, in
+// ranking order.
+func DistinctSenses(entry DictionaryEntry, limit int) []Sense {
+	var senses []Sense
+	seen := map[string]bool{}
+	for _, sense := range entry.Senses {
+		if len(senses) >= limit {
+			break
+		}
+		if sense.Text == "" || seen[sense.Text] {
+			continue
+		}
+		seen[sense.Text] = true
+		senses = append(senses, sense)
+	}
+	return senses
+}
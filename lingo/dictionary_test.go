@@ -0,0 +1,62 @@
+package lingo
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFirstTranslation(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string // Yandex lookup response
+		want    string
+		wantOK  bool
+	}{
+		{
+			name: "real response",
+			payload: `{"head": {}, "def": [{"text": "cat", "pos": "noun", "ts": "kæt",
+				"tr": [{"text": "кошка", "pos": "noun", "fr": 10, "syn": [{"text": "кот"}]},
+				       {"text": "кошечка", "pos": "noun", "fr": 1}]}]}`,
+			want:   "кошка",
+			wantOK: true,
+		},
+		{
+			name:    "empty def",
+			payload: `{"head": {}, "def": []}`,
+		},
+		{
+			name:    "missing def",
+			payload: `{"head": {}}`,
+		},
+		{
+			name:    "empty tr",
+			payload: `{"head": {}, "def": [{"text": "cat", "pos": "noun", "tr": []}]}`,
+		},
+		{
+			name: "empty tr before a translated definition",
+			payload: `{"head": {}, "def": [{"text": "run", "pos": "noun", "tr": []},
+				{"text": "run", "pos": "verb", "tr": [{"text": "бежать"}]}]}`,
+			want:   "бежать",
+			wantOK: true,
+		},
+		{
+			name: "multiple definitions",
+			payload: `{"head": {}, "def": [{"text": "run", "pos": "verb", "tr": [{"text": "бежать"}, {"text": "бегать"}]},
+				{"text": "run", "pos": "noun", "tr": [{"text": "пробег"}]}]}`,
+			want:   "бежать",
+			wantOK: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result DicResult
+			if err := json.Unmarshal([]byte(tt.payload), &result); err != nil {
+				t.Fatal(err)
+			}
+			got, ok := firstTranslation(result.entry())
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("firstTranslation = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
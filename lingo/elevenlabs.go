@@ -0,0 +1,342 @@
+package lingo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ElevenLabsRequest represents the request structure for ElevenLabs TTS API
+type ElevenLabsRequest struct {
+	Text          string        `json:"text"`
+	ModelID       string        `json:"model_id"`
+	VoiceID       string        `json:"voice_id"`
+	VoiceSettings VoiceSettings `json:"voice_settings"`
+}
+
+type VoiceSettings struct {
+	Stability       float64 `json:"stability"`
+	SimilarityBoost float64 `json:"similarity_boost"`
+}
+
+// Model and voice settings sent with every ElevenLabs request.
+const (
+	elevenLabsModel           = "eleven_multilingual_v2"
+	elevenLabsStability       = 0.5
+	elevenLabsSimilarityBoost = 0.5
+	// ElevenLabsMaxChars is the longest text the model accepts per request.
+	ElevenLabsMaxChars = 10000
+	// elevenLabsThrottleRetries is how often a request refused for too many
+	// concurrent requests is repeated before it fails.
+	elevenLabsThrottleRetries = 5
+)
+
+// ElevenLabsTTS synthesizes speech with the ElevenLabs text-to-speech API.
+type ElevenLabsTTS struct {
+	ctx          context.Context // ends the waits between retries
+	client       *http.Client
+	baseURL      string
+	apiKey       string
+	voiceID      string
+	langVoices   map[string]string // language -> voice ID used instead of voiceID
+	outputFormat string
+	extension    string
+	headers      http.Header // extra request headers, e.g. for team accounts
+	logs         *Logger
+
+	voicesOnce sync.Once
+	voices     []Voice
+	voicesErr  error
+
+	// quotaExceeded is set once a request failed for the account's character
+	// quota, after which no more requests are sent.
+	quotaExceeded atomic.Bool
+}
+
+// elevenLabsError is the error object ElevenLabs returns with a failed
+// request. Validation errors use a different detail and decode as empty.
+type elevenLabsError struct {
+	Detail struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	} `json:"detail"`
+}
+
+// throttledError is a 429 for too many concurrent requests, which clears up
+// as soon as earlier requests finish.
+type throttledError struct {
+	retryAfter time.Duration // from the Retry-After header, 0 when missing
+	message    string
+}
+
+func (t *throttledError) Error() string {
+	return "ElevenLabs API error: 429 - " + t.message
+}
+
+// Voice is a voice available to an ElevenLabs account.
+type Voice struct {
+	ID   string `json:"voice_id"`
+	Name string `json:"name"`
+}
+
+// DefaultElevenLabsBaseURL is the public ElevenLabs text-to-speech endpoint.
+const DefaultElevenLabsBaseURL = "https://api.elevenlabs.io/v1/text-to-speech"
+
+// NewElevenLabsTTS returns a provider speaking with voiceID, or with the voice
+// langVoices maps the spoken language to, and producing audio in
+// outputFormat, such as "mp3_44100_128". An empty baseURL selects
+// DefaultElevenLabsBaseURL; headers are added to every request. Retries of
+// throttled requests stop waiting once ctx is done.
+func NewElevenLabsTTS(ctx context.Context, client *http.Client, baseURL, apiKey, voiceID string, langVoices map[string]string, outputFormat string, headers http.Header, logs *Logger) (*ElevenLabsTTS, error) {
+	ext, err := AudioExtension(outputFormat)
+	if err != nil {
+		return nil, err
+	}
+	if baseURL == "" {
+		baseURL = DefaultElevenLabsBaseURL
+	}
+	return &ElevenLabsTTS{
+		ctx:          ctx,
+		client:       client,
+		baseURL:      baseURL,
+		apiKey:       apiKey,
+		voiceID:      voiceID,
+		langVoices:   langVoices,
+		outputFormat: outputFormat,
+		extension:    ext,
+		headers:      headers,
+		logs:         logs,
+	}, nil
+}
+
+// audioExtensions maps the codec prefix of an ElevenLabs output_format to the
+// extension of the files it produces.
+var audioExtensions = map[string]string{
+	"mp3":  "mp3",
+	"opus": "opus",
+	"pcm":  "pcm",
+	"ulaw": "ulaw",
+	"alaw": "alaw",
+}
+
+// AudioExtension returns the file extension for an ElevenLabs output_format
+// such as "mp3_44100_128".
+func AudioExtension(format string) (string, error) {
+	codec, _, _ := strings.Cut(format, "_")
+	ext, ok := audioExtensions[codec]
+	if !ok {
+		return "", fmt.Errorf("unsupported audio format %q", format)
+	}
+	return ext, nil
+}
+
+// Voices returns the voices available to the account. The list is fetched
+// once and reused afterwards.
+func (e *ElevenLabsTTS) Voices() ([]Voice, error) {
+	e.voicesOnce.Do(func() {
+		e.voices, e.voicesErr = e.fetchVoices()
+	})
+	return e.voices, e.voicesErr
+}
+
+// fetchVoices requests the voice list from the endpoint next to the
+// text-to-speech one, e.g. /v1/voices for /v1/text-to-speech.
+func (e *ElevenLabsTTS) fetchVoices() ([]Voice, error) {
+	u, err := url.Parse(e.baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing base URL: %w", err)
+	}
+	u.Path = path.Join(path.Dir(u.Path), "voices")
+	e.logs.For("voices_request", "").Debugf("ElevenLabs voices request: GET %s", u)
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating HTTP request: %w", err)
+	}
+	req.Header.Set("xi-api-key", e.apiKey)
+	for key, values := range e.headers {
+		req.Header[key] = values
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching voices: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading voices: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ElevenLabs API error: %d - %s", resp.StatusCode, truncateBody(body))
+	}
+	var list struct {
+		Voices []Voice `json:"voices"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("parsing voices: %w", err)
+	}
+	return list.Voices, nil
+}
+
+// CheckVoice verifies that the configured voices exist, so a mistyped ID
+// fails once up front instead of once per word.
+func (e *ElevenLabsTTS) CheckVoice() error {
+	voices, err := e.Voices()
+	if err != nil {
+		return err
+	}
+	known := map[string]bool{}
+	available := make([]string, len(voices))
+	for i, v := range voices {
+		known[v.ID] = true
+		available[i] = fmt.Sprintf("%s (%s)", v.Name, v.ID)
+	}
+	configured := []string{e.voiceID}
+	for _, lang := range slices.Sorted(maps.Keys(e.langVoices)) {
+		configured = append(configured, e.langVoices[lang])
+	}
+	for _, id := range configured {
+		if !known[id] {
+			return fmt.Errorf("voice %s not found; available voices: %s", id, strings.Join(available, ", "))
+		}
+	}
+	return nil
+}
+
+// voiceFor returns the voice speaking lang.
+func (e *ElevenLabsTTS) voiceFor(lang string) string {
+	if id, ok := e.langVoices[lang]; ok {
+		return id
+	}
+	return e.voiceID
+}
+
+// Extension returns the file extension matching the configured output format.
+func (e *ElevenLabsTTS) Extension() string {
+	return e.extension
+}
+
+// Fingerprint identifies the voices, model, settings and output format.
+func (e *ElevenLabsTTS) Fingerprint() string {
+	voices := e.voiceID
+	for _, lang := range slices.Sorted(maps.Keys(e.langVoices)) {
+		voices += "," + lang + "=" + e.langVoices[lang]
+	}
+	return fmt.Sprintf("elevenlabs|%s|%s|%g|%g|%s", voices, elevenLabsModel, elevenLabsStability, elevenLabsSimilarityBoost, e.outputFormat)
+}
+
+// Synthesize generates speech for text. ElevenLabs detects the language from
+// the text itself, so lang only selects the voice. Requests refused for too
+// many concurrent requests are retried after a short wait; once the character
+// quota is used up, this and every later call fail with ErrQuotaExceeded.
+func (e *ElevenLabsTTS) Synthesize(text, lang string) ([]byte, error) {
+	for attempt := 1; ; attempt++ {
+		if e.quotaExceeded.Load() {
+			return nil, ErrQuotaExceeded
+		}
+		audio, err := e.synthesize(text, lang)
+		if errors.Is(err, ErrQuotaExceeded) && e.quotaExceeded.CompareAndSwap(false, true) {
+			e.logs.For("tts_quota_exceeded", "").Errorf("%v; no more audio is generated this run", err)
+		}
+		var throttled *throttledError
+		if !errors.As(err, &throttled) || attempt > elevenLabsThrottleRetries {
+			return audio, err
+		}
+		wait := throttled.retryAfter
+		if wait <= 0 {
+			wait = time.Duration(attempt) * time.Second
+		}
+		e.logs.For("tts_throttled", "").Verbosef("ElevenLabs is busy with other requests, retrying in %s", wait)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-e.ctx.Done():
+			timer.Stop()
+			return nil, e.ctx.Err()
+		}
+	}
+}
+
+// synthesize sends a single request for text.
+func (e *ElevenLabsTTS) synthesize(text, lang string) ([]byte, error) {
+	voiceID := e.voiceFor(lang)
+	// Prepare request for ElevenLabs
+	elevenLabsReq := ElevenLabsRequest{
+		Text:    text,
+		ModelID: elevenLabsModel,
+		VoiceID: voiceID,
+		VoiceSettings: VoiceSettings{
+			Stability:       elevenLabsStability,
+			SimilarityBoost: elevenLabsSimilarityBoost,
+		},
+	}
+
+	reqBody, err := json.Marshal(elevenLabsReq)
+	if err != nil {
+		return nil, fmt.Errorf("creating request for ElevenLabs: %w", err)
+	}
+
+	// Create the HTTP request
+	requestURL := fmt.Sprintf("%s/%s?%s", e.baseURL, voiceID, url.Values{"output_format": {e.outputFormat}}.Encode())
+	e.logs.For("tts_request", "").Debugf("ElevenLabs request for %s: POST %s %s", text, requestURL, reqBody)
+	req, err := http.NewRequest("POST", requestURL, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("creating HTTP request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("xi-api-key", e.apiKey)
+	for key, values := range e.headers {
+		req.Header[key] = values
+	}
+
+	// Execute the request
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("generating audio: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		responseBody, _ := io.ReadAll(resp.Body)
+		// A spent quota and too many concurrent requests both come as 429
+		// (the quota also as 401) and are told apart by the detail status.
+		var apiErr elevenLabsError
+		if json.Unmarshal(responseBody, &apiErr) == nil {
+			switch status := apiErr.Detail.Status; {
+			case status == "quota_exceeded":
+				return nil, fmt.Errorf("%w: %s", ErrQuotaExceeded, apiErr.Detail.Message)
+			case resp.StatusCode == http.StatusTooManyRequests && (status == "too_many_concurrent_requests" || status == "system_busy"):
+				seconds, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+				return nil, &throttledError{retryAfter: time.Duration(seconds) * time.Second, message: apiErr.Detail.Message}
+			}
+		}
+		return nil, fmt.Errorf("ElevenLabs API error: %d - %s", resp.StatusCode, string(responseBody))
+	}
+
+	audio, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading audio: %w", err)
+	}
+	// A truncated body must never be saved as if it were complete.
+	if resp.ContentLength >= 0 && int64(len(audio)) != resp.ContentLength {
+		return nil, fmt.Errorf("reading audio: got %d of %d bytes", len(audio), resp.ContentLength)
+	}
+	if len(audio) == 0 {
+		return nil, fmt.Errorf("reading audio: empty response")
+	}
+	return audio, nil
+}
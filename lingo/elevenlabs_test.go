@@ -0,0 +1,80 @@
+package lingo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestElevenLabs returns a provider sending its requests to handler.
+func newTestElevenLabs(t *testing.T, handler http.HandlerFunc) *ElevenLabsTTS {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	tts, err := NewElevenLabsTTS(context.Background(), server.Client(), server.URL+"/v1/text-to-speech", "key", "voice", nil, "mp3_44100_128", nil, NewLogger(LevelQuiet, io.Discard, io.Discard))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tts
+}
+
+func TestSynthesizeShortRead(t *testing.T) {
+	// The connection closes after 10 of the 100 announced bytes.
+	tts := newTestElevenLabs(t, func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 200 OK\r\nContent-Type: audio/mpeg\r\nContent-Length: 100\r\n\r\nID3partial")
+		buf.Flush()
+	})
+	if audio, err := tts.Synthesize("cat", "en"); err == nil {
+		t.Errorf("Synthesize = %d bytes, want an error for the truncated body", len(audio))
+	}
+}
+
+func TestSynthesize(t *testing.T) {
+	tts := newTestElevenLabs(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/text-to-speech/voice" || r.URL.Query().Get("output_format") != "mp3_44100_128" {
+			t.Errorf("request to %s", r.URL)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), `"text":"cat"`) {
+			t.Errorf("request body %s", body)
+		}
+		w.Write([]byte("ID3cat"))
+	})
+	audio, err := tts.Synthesize("cat", "en")
+	if err != nil || string(audio) != "ID3cat" {
+		t.Errorf("Synthesize = %q, %v, want %q", audio, err, "ID3cat")
+	}
+}
+
+func TestSynthesizeThrottledStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"detail": {"status": "too_many_concurrent_requests", "message": "busy"}}`))
+	}))
+	defer server.Close()
+	tts, err := NewElevenLabsTTS(ctx, server.Client(), server.URL+"/v1/text-to-speech", "key", "voice", nil, "mp3_44100_128", nil, NewLogger(LevelQuiet, io.Discard, io.Discard))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err := tts.Synthesize("cat", "en"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Synthesize = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if waited := time.Since(start); waited > 5*time.Second {
+		t.Errorf("Synthesize waited %s for the retry after the deadline", waited)
+	}
+}
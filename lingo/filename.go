@@ -0,0 +1,181 @@
+package lingo
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxFilenameBase is the longest base name (without extension) kept verbatim.
+// Longer names are shortened and suffixed with a hash so they stay unique.
+const maxFilenameBase = 64
+
+// SanitizeFilename turns a word into a portable file base name. It trims and
+// lowercases the word, replaces whitespace with underscores and drops
+// characters that are unsafe on common filesystems. Names that are too long,
+// empty after cleaning, or (with asciiOnly) contain non-ASCII letters are
+// replaced by or suffixed with a short hash of the original word.
+func SanitizeFilename(word string, asciiOnly bool) string {
+	word = strings.ToLower(strings.TrimSpace(word))
+
+	var b strings.Builder
+	nonASCII := false
+	lastUnderscore := false
+	for _, r := range word {
+		switch {
+		case unicode.IsSpace(r) || r == '_':
+			if !lastUnderscore && b.Len() > 0 {
+				b.WriteRune('_')
+				lastUnderscore = true
+			}
+			continue
+		case strings.ContainsRune(`/\:*?"<>|`, r) || unicode.IsControl(r):
+			continue
+		case r > unicode.MaxASCII:
+			nonASCII = true
+		}
+		b.WriteRune(r)
+		lastUnderscore = false
+	}
+	name := strings.Trim(b.String(), "._")
+
+	if name == "" || (asciiOnly && nonASCII) {
+		return shortHash(word)
+	}
+	if len(name) > maxFilenameBase {
+		cut := maxFilenameBase
+		for cut > 0 && !utf8.RuneStart(name[cut]) {
+			cut--
+		}
+		return name[:cut] + "_" + shortHash(word)
+	}
+	return name
+}
+
+// ParseAudioNameTemplate checks an audio naming template such as
+// "{lang}/{word}" or "{index}_{word}" and returns it without a trailing
+// ".ext", since the extension always follows the audio format. The
+// placeholders are {word}, the sanitized word; {lang}, the language it is
+// spoken in; {index}, its 1-based position in the input, padded to four
+// digits; and {hash}, the hash -hash-filenames names files by. Slashes
+// separate subdirectories of the audio directory.
+func ParseAudioNameTemplate(template, ext string) (string, error) {
+	template = strings.TrimSuffix(template, "."+ext)
+	for _, segment := range strings.Split(template, "/") {
+		literal := strings.NewReplacer("{word}", "", "{lang}", "", "{index}", "", "{hash}", "").Replace(segment)
+		switch {
+		case segment == "" || segment == "." || segment == "..":
+			return "", fmt.Errorf("%q is not a relative path inside the audio directory", template)
+		case strings.ContainsAny(literal, "{}"):
+			return "", fmt.Errorf("unknown placeholder in %q, want {word}, {lang}, {index} or {hash}", template)
+		case strings.ContainsFunc(literal, func(r rune) bool { return strings.ContainsRune(`\:*?"<>|`, r) || unicode.IsControl(r) }):
+			return "", fmt.Errorf("%q has characters that are unsafe in file names", template)
+		}
+	}
+	if !strings.Contains(template, "{word}") && !strings.Contains(template, "{index}") && !strings.Contains(template, "{hash}") {
+		return "", fmt.Errorf("%q needs {word}, {index} or {hash} to give every word its own file", template)
+	}
+	return template, nil
+}
+
+// expandAudioName fills in the {word} and {index} placeholders of template,
+// which are known before the lookup; {lang} and {hash} are left for
+// Processor.Voice. An empty template names the file after the word alone.
+func expandAudioName(template, word string, index int) string {
+	if template == "" {
+		return word
+	}
+	return strings.NewReplacer("{word}", word, "{index}", fmt.Sprintf("%04d", index)).Replace(template)
+}
+
+// AssignAudioFiles picks the audio file name of every entry that gets audio,
+// following the naming template when there is one (see
+// ParseAudioNameTemplate). Entries with the same term share a file unless
+// the template tells them apart; different terms that sanitize to the same
+// name (e.g. "Run" and "run") get a numeric suffix instead of overwriting
+// each other.
+func AssignAudioFiles(entries []Entry, asciiOnly bool, template, ext string, logs *Logger) {
+	n := NewAudioNamer(asciiOnly, template, ext, logs)
+	for i := range entries {
+		n.Assign(&entries[i])
+	}
+}
+
+// AudioNamer names audio files like AssignAudioFiles, one entry at a time, so
+// entries can be named as they are read.
+type AudioNamer struct {
+	asciiOnly      bool
+	template, ext  string
+	logs           *Logger
+	owners, byTerm map[string]string // base name -> term, term -> base name
+}
+
+// NewAudioNamer returns a namer with the settings of AssignAudioFiles.
+func NewAudioNamer(asciiOnly bool, template, ext string, logs *Logger) *AudioNamer {
+	return &AudioNamer{
+		asciiOnly: asciiOnly,
+		template:  template,
+		ext:       ext,
+		logs:      logs,
+		owners:    map[string]string{},
+		byTerm:    map[string]string{},
+	}
+}
+
+// Assign picks the audio file name of e, given the entries named before it.
+func (n *AudioNamer) Assign(e *Entry) {
+	if e.Override != nil && e.Override.SkipAudio {
+		return
+	}
+	base, ok := n.byTerm[e.Term]
+	if !ok {
+		base = SanitizeFilename(e.Term, n.asciiOnly)
+		for i := 2; ; i++ {
+			owner, taken := n.owners[base]
+			if !taken || owner == e.Term {
+				break
+			}
+			if i == 2 {
+				n.logs.For("filename_collision", e.Term).Warnf("%s and %s share the audio file name %s", owner, e.Term, base)
+			}
+			base = SanitizeFilename(e.Term, n.asciiOnly) + "_" + strconv.Itoa(i)
+		}
+		n.owners[base] = e.Term
+		n.byTerm[e.Term] = base
+	}
+	e.AudioFile = expandAudioName(n.template, base, e.Seq+1) + "." + n.ext
+}
+
+// IsAudioFileName reports whether base is the name AssignAudioFiles may have
+// given to word's audio: its sanitized form, optionally with a numeric suffix.
+func IsAudioFileName(base, word string, asciiOnly bool) bool {
+	name := SanitizeFilename(word, asciiOnly)
+	if base == name {
+		return true
+	}
+	suffix, ok := strings.CutPrefix(base, name+"_")
+	if !ok {
+		return false
+	}
+	n, err := strconv.Atoi(suffix)
+	return err == nil && n >= 2 && suffix == strconv.Itoa(n)
+}
+
+// ExampleAudioFile returns the name of the audio file for a word's example
+// sentence, next to the word's own audioFile. The name carries a hash of the
+// sentence, so an edited example gets new audio instead of reusing the old.
+func ExampleAudioFile(audioFile, sentence string) string {
+	ext := filepath.Ext(audioFile)
+	return strings.TrimSuffix(audioFile, ext) + "_ex_" + shortHash(sentence) + ext
+}
+
+// shortHash returns the first 12 hex characters of the SHA-1 of s.
+func shortHash(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])[:12]
+}
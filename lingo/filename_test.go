@@ -0,0 +1,119 @@
+package lingo
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeFilename(t *testing.T) {
+	long := strings.Repeat("a", 70)
+	longCyrillic := strings.Repeat("ж", 40) // 80 bytes
+	tests := []struct {
+		word      string
+		asciiOnly bool
+		want      string
+	}{
+		{word: "cat", want: "cat"},
+		{word: "Cat", want: "cat"},
+		{word: "to run away", want: "to_run_away"},
+		{word: "to  run \t away", want: "to_run_away"},
+		{word: "  padded  ", want: "padded"},
+		{word: "and/or", want: "andor"},
+		{word: "re: hello", want: "re_hello"},
+		{word: `a\b:c*d?e"f<g>h|i`, want: "abcdefghi"},
+		{word: "snake_case word", want: "snake_case_word"},
+		{word: ".hidden.", want: "hidden"},
+		{word: "кошка", want: "кошка"},
+		{word: "Über", want: "über"},
+		{word: "кошка", asciiOnly: true, want: shortHash("кошка")},
+		{word: "/:*", want: shortHash("/:*")},
+		{word: "   ", want: shortHash("")},
+		{word: long, want: long[:maxFilenameBase] + "_" + shortHash(long)},
+		// Cut on a rune boundary: 32 runes fill 64 bytes exactly.
+		{word: longCyrillic, want: strings.Repeat("ж", 32) + "_" + shortHash(longCyrillic)},
+		{word: "a" + longCyrillic, want: "a" + strings.Repeat("ж", 31) + "_" + shortHash("a"+longCyrillic)},
+	}
+	for _, tt := range tests {
+		if got := SanitizeFilename(tt.word, tt.asciiOnly); got != tt.want {
+			t.Errorf("SanitizeFilename(%q, %v) = %q, want %q", tt.word, tt.asciiOnly, got, tt.want)
+		}
+	}
+}
+
+func TestAssignAudioFiles(t *testing.T) {
+	tests := []struct {
+		name      string
+		terms     []string
+		asciiOnly bool
+		template  string
+		want      []string // audio file of each term, "" without audio
+		warnings  int      // collisions logged
+	}{
+		{
+			name:  "distinct",
+			terms: []string{"cat", "dog"},
+			want:  []string{"cat.mp3", "dog.mp3"},
+		},
+		{
+			name:  "same term shares its file",
+			terms: []string{"bank", "bank"},
+			want:  []string{"bank.mp3", "bank.mp3"},
+		},
+		{
+			name:     "homographs by case",
+			terms:    []string{"Polish", "polish", "POLISH", "polish"},
+			want:     []string{"polish.mp3", "polish_2.mp3", "polish_3.mp3", "polish_2.mp3"},
+			warnings: 2,
+		},
+		{
+			name:     "unsafe characters",
+			terms:    []string{"and/or", "andor", "and:or"},
+			want:     []string{"andor.mp3", "andor_2.mp3", "andor_3.mp3"},
+			warnings: 2,
+		},
+		{
+			name:     "suffix taken by another word",
+			terms:    []string{"run", "run_2", "Run"},
+			want:     []string{"run.mp3", "run_2.mp3", "run_3.mp3"},
+			warnings: 1,
+		},
+		{
+			name:     "template",
+			terms:    []string{"Run", "run"},
+			template: "{index}_{word}",
+			want:     []string{"0001_run.mp3", "0002_run_2.mp3"},
+			warnings: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := make([]Entry, len(tt.terms))
+			for i, term := range tt.terms {
+				entries[i] = Entry{Seq: i, Word: term, Term: term}
+			}
+			var log strings.Builder
+			AssignAudioFiles(entries, tt.asciiOnly, tt.template, "mp3", NewLogger(LevelNormal, &log, io.Discard))
+			for i, e := range entries {
+				if e.AudioFile != tt.want[i] {
+					t.Errorf("%s: audio file %q, want %q", e.Term, e.AudioFile, tt.want[i])
+				}
+			}
+			if n := strings.Count(log.String(), "share the audio file name"); n != tt.warnings {
+				t.Errorf("logged %d collisions, want %d:\n%s", n, tt.warnings, log.String())
+			}
+		})
+	}
+}
+
+func TestAssignAudioFilesSkipAudio(t *testing.T) {
+	entries := []Entry{
+		{Word: "run", Term: "run", Override: &Override{SkipAudio: true}},
+		{Word: "Run", Term: "Run", Seq: 1},
+	}
+	AssignAudioFiles(entries, false, "", "mp3", NewLogger(LevelQuiet, io.Discard, io.Discard))
+	// The skipped entry takes no file, so the other keeps the plain name.
+	if entries[0].AudioFile != "" || entries[1].AudioFile != "run.mp3" {
+		t.Errorf("audio files %q and %q, want none and run.mp3", entries[0].AudioFile, entries[1].AudioFile)
+	}
+}
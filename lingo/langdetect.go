@@ -0,0 +1,109 @@
+package lingo
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// languageProfile describes how a language can be recognised from a single
+// word: the script it is written in and the letters that set it apart from
+// other languages using the same script.
+type languageProfile struct {
+	script      *unicode.RangeTable
+	distinctive string
+}
+
+// languageProfiles lists the languages LangDetectingDictionary can recognise.
+var languageProfiles = map[string]languageProfile{
+	"en": {unicode.Latin, ""},
+	"de": {unicode.Latin, "äöüß"},
+	"fr": {unicode.Latin, "éèêëàâçîïôûùœ"},
+	"es": {unicode.Latin, "ñáéíóúü¿¡"},
+	"it": {unicode.Latin, "àèéìòù"},
+	"pt": {unicode.Latin, "ãõáâêôçà"},
+	"pl": {unicode.Latin, "ąćęłńóśźż"},
+	"ru": {unicode.Cyrillic, "ыэъё"},
+	"uk": {unicode.Cyrillic, "іїєґ"},
+	"el": {unicode.Greek, ""},
+}
+
+// detectLanguage guesses the language of word among candidates. Only
+// candidates written in the word's script are considered; among those the one
+// with the most distinctive letters wins, and ties go to the earlier
+// candidate. ok is false when no candidate uses the word's script.
+func detectLanguage(word string, candidates []string) (lang string, ok bool) {
+	word = strings.ToLower(word)
+	best := -1
+	for _, candidate := range candidates {
+		profile, known := languageProfiles[candidate]
+		if !known || !writtenIn(word, profile.script) {
+			continue
+		}
+		score := 0
+		for _, r := range word {
+			if strings.ContainsRune(profile.distinctive, r) {
+				score++
+			}
+		}
+		if score > best {
+			lang, best = candidate, score
+		}
+	}
+	return lang, best >= 0
+}
+
+// writtenIn reports whether every letter of word belongs to script.
+func writtenIn(word string, script *unicode.RangeTable) bool {
+	letters := 0
+	for _, r := range word {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		if !unicode.Is(script, r) {
+			return false
+		}
+		letters++
+	}
+	return letters > 0
+}
+
+// LangDetectingDictionary routes every lookup to the dictionary for the
+// word's detected source language.
+type LangDetectingDictionary struct {
+	candidates []string
+	target     string
+	dicts      map[string]DictionaryProvider // source language -> dictionary
+	logs       *Logger
+}
+
+// NewLangDetectingDictionary sets up a dictionary translating from each
+// candidate language into target. A candidate equal to target gets none, so
+// words detected as already being in the target language are skipped.
+func NewLangDetectingDictionary(candidates []string, target string, newDict func(lang string) DictionaryProvider, logs *Logger) (*LangDetectingDictionary, error) {
+	d := &LangDetectingDictionary{candidates: candidates, target: target, dicts: map[string]DictionaryProvider{}, logs: logs}
+	for _, lang := range candidates {
+		if _, ok := languageProfiles[lang]; !ok {
+			return nil, fmt.Errorf("cannot detect language %q", lang)
+		}
+		if lang != target {
+			d.dicts[lang] = newDict(lang + "-" + target)
+		}
+	}
+	return d, nil
+}
+
+func (d *LangDetectingDictionary) Lookup(word string) (DictionaryEntry, error) {
+	lang, ok := detectLanguage(word, d.candidates)
+	if !ok {
+		return DictionaryEntry{}, fmt.Errorf("language of %q is none of %s", word, strings.Join(d.candidates, ", "))
+	}
+	dict, ok := d.dicts[lang]
+	if !ok {
+		return DictionaryEntry{}, fmt.Errorf("%q looks like %s, which has no translation into %s configured", word, lang, d.target)
+	}
+	d.logs.For("lang_detected", word).Debugf("Detected %s as %s", word, lang)
+	entry, err := dict.Lookup(word)
+	entry.Lang = lang
+	return entry, err
+}
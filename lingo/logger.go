@@ -0,0 +1,242 @@
+package lingo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogLevel controls how much the tool reports while it runs.
+type LogLevel int
+
+const (
+	// LevelQuiet prints only the final summary.
+	LevelQuiet LogLevel = iota
+	// LevelNormal adds errors, created audio files and the progress line.
+	LevelNormal
+	// LevelVerbose adds routine messages such as skipped audio files.
+	LevelVerbose
+	// LevelDebug adds request URLs and truncated response bodies.
+	LevelDebug
+)
+
+// debugBodyLimit is the number of response bytes shown in debug output.
+const debugBodyLimit = 512
+
+// ParseLogLevel parses a level name: quiet, normal, verbose or debug.
+func ParseLogLevel(s string) (LogLevel, error) {
+	switch s {
+	case "quiet":
+		return LevelQuiet, nil
+	case "normal":
+		return LevelNormal, nil
+	case "verbose":
+		return LevelVerbose, nil
+	case "debug":
+		return LevelDebug, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q (want quiet, normal, verbose or debug)", s)
+}
+
+// Logger gates log output by level and keeps the progress line on the
+// terminal redrawn after every message. It is safe for concurrent use, and a
+// nil *Logger discards everything.
+//
+// A JSON logger writes one object per message instead, with the level, the
+// event and word set by For, the message and the error among its arguments,
+// and draws no progress line.
+type Logger struct {
+	*sink
+	event string
+	word  string
+}
+
+// sink is the output shared by a Logger and the loggers derived from it.
+type sink struct {
+	mu       sync.Mutex
+	level    LogLevel
+	out      *log.Logger // text output
+	json     *json.Encoder
+	progress io.Writer
+	// clear is set when out is the terminal the progress line is drawn on,
+	// which a message has to erase before it is printed.
+	clear    bool
+	messages *Messages // language of the progress line
+	done     int
+	total    int
+}
+
+// logRecord is a message of a JSON logger.
+type logRecord struct {
+	Time    string `json:"time"`
+	Level   string `json:"level"`
+	Event   string `json:"event,omitempty"`
+	Word    string `json:"word,omitempty"`
+	Message string `json:"message"`
+	Error   string `json:"error,omitempty"`
+}
+
+// NewLogger returns a logger writing messages up to level to out and the
+// progress line to progress.
+func NewLogger(level LogLevel, out, progress io.Writer) *Logger {
+	return &Logger{sink: &sink{
+		level:    level,
+		out:      log.New(out, "", log.LstdFlags),
+		progress: progress,
+		clear:    sameTerminal(out, progress),
+	}}
+}
+
+// sameTerminal reports whether out and progress both write to the same
+// terminal, e.g. stderr and stdout of an interactive shell.
+func sameTerminal(out, progress io.Writer) bool {
+	outFile, ok := out.(*os.File)
+	if !ok {
+		return false
+	}
+	progressFile, ok := progress.(*os.File)
+	if !ok {
+		return false
+	}
+	outInfo, err := outFile.Stat()
+	if err != nil || outInfo.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	progressInfo, err := progressFile.Stat()
+	return err == nil && os.SameFile(outInfo, progressInfo)
+}
+
+// NewJSONLogger returns a logger writing messages up to level to out as JSON
+// lines, for log collectors rather than terminals.
+func NewJSONLogger(level LogLevel, out io.Writer) *Logger {
+	return &Logger{sink: &sink{
+		level: level,
+		json:  json.NewEncoder(out),
+	}}
+}
+
+// For returns a logger that tags its messages with an event name and the
+// word they concern; either may be empty. Text output is unchanged.
+func (l *Logger) For(event, word string) *Logger {
+	if l == nil {
+		return nil
+	}
+	return &Logger{sink: l.sink, event: event, word: word}
+}
+
+// Errorf logs a failure for a single word.
+func (l *Logger) Errorf(format string, args ...any) {
+	l.logf(LevelNormal, "error", format, args...)
+}
+
+// Warnf logs a problem the run recovers from.
+func (l *Logger) Warnf(format string, args ...any) {
+	l.logf(LevelNormal, "warn", format, args...)
+}
+
+// Infof logs a noteworthy event such as a newly created audio file.
+func (l *Logger) Infof(format string, args ...any) {
+	l.logf(LevelNormal, "info", format, args...)
+}
+
+// Verbosef logs routine events that are usually only noise.
+func (l *Logger) Verbosef(format string, args ...any) {
+	l.logf(LevelVerbose, "verbose", format, args...)
+}
+
+// Debugf logs raw request and response details.
+func (l *Logger) Debugf(format string, args ...any) {
+	l.logf(LevelDebug, "debug", format, args...)
+}
+
+// Writer returns a writer that logs every line written to it as an error,
+// whatever the level. It lets messages of the standard log package, such as
+// fatal errors, reach the same output.
+func (l *Logger) Writer() io.Writer {
+	return logWriter{l}
+}
+
+type logWriter struct {
+	l *Logger
+}
+
+func (w logWriter) Write(p []byte) (int, error) {
+	w.l.logf(LevelQuiet, "error", "%s", strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
+
+// SetMessages sets the interface language of the progress line.
+func (l *Logger) SetMessages(m *Messages) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages = m
+}
+
+// Progress records and redraws the current progress. A negative total is
+// not known yet, e.g. while a workbook is still being read, and only done is
+// shown.
+func (l *Logger) Progress(done, total int) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.done, l.total = done, total
+	l.redraw()
+}
+
+func (l *Logger) logf(level LogLevel, name, format string, args ...any) {
+	if l == nil || l.level < level {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.json != nil {
+		record := logRecord{
+			Time:    time.Now().Format(time.RFC3339),
+			Level:   name,
+			Event:   l.event,
+			Word:    l.word,
+			Message: fmt.Sprintf(format, args...),
+		}
+		for _, arg := range args {
+			if err, ok := arg.(error); ok {
+				record.Error = err.Error()
+			}
+		}
+		l.json.Encode(record)
+		return
+	}
+	if name == "warn" {
+		format = "Warning: " + format
+	}
+	if l.clear {
+		io.WriteString(l.out.Writer(), "\r\033[2K")
+	}
+	l.out.Printf(format, args...)
+	l.redraw()
+}
+
+func (l *Logger) redraw() {
+	if l.level < LevelNormal || l.json != nil {
+		return
+	}
+	if l.total < 0 {
+		fmt.Fprint(l.progress, "\r\033[2K"+l.messages.Sprintf("Current progress: %d", l.done))
+		return
+	}
+	fmt.Fprint(l.progress, "\r\033[2K"+l.messages.Sprintf("Current progress: %d/%d", l.done, l.total))
+}
+
+// truncateBody shortens a response body for debug output.
+func truncateBody(body []byte) string {
+	if len(body) <= debugBodyLimit {
+		return string(body)
+	}
+	return string(body[:debugBodyLimit]) + "..."
+}
@@ -0,0 +1,39 @@
+package lingo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoggerClearsOnlyTerminalProgress(t *testing.T) {
+	// With -log-file the messages go to a file and the progress elsewhere.
+	dir := t.TempDir()
+	path := filepath.Join(dir, "run.log")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	progress, err := os.Create(filepath.Join(dir, "progress"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer progress.Close()
+	logs := NewLogger(LevelNormal, f, progress)
+	logs.Infof("Processing word: %s", "cat")
+	logs.Warnf("%s has no definition", "cat")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "\033[2K") {
+		t.Errorf("log file has terminal escapes: %q", data)
+	}
+	for _, want := range []string{" Processing word: cat\n", " Warning: cat has no definition\n"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("log file %q lacks %q", data, want)
+		}
+	}
+}
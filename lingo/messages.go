@@ -0,0 +1,73 @@
+package lingo
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// catalogs translate the English progress and summary lines, keyed by their
+// English format, into other interface languages. Formats missing from a
+// catalog are shown in English. Russian avoids numerals agreeing with nouns
+// by putting the count after a colon or dash.
+var catalogs = map[string]map[string]string{
+	"ru": {
+		"Current progress: %d/%d": "Прогресс: %d/%d",
+		"Current progress: %d":    "Прогресс: %d",
+		"API usage: %d translation lookups, %d synthesis requests, %d characters synthesized": "Использование API: запросов перевода — %d, запросов синтеза — %d, озвучено символов — %d",
+		"Estimated synthesis cost: %.2f":                   "Примерная стоимость синтеза: %.2f",
+		"Preview of %q written to %s":                      "Образец %q записан в %s",
+		"Stopped early because the -deadline of %s passed": "Остановлено досрочно: истёк срок -deadline (%s)",
+		"Created %d missing audio files, %d failed":        "Создано недостающих аудиофайлов: %d, с ошибкой: %d",
+		"Estimate for %d words: %d translation lookups, %d synthesis requests, %d characters to synthesize": "Оценка, слов: %d. Запросов перевода — %d, запросов синтеза — %d, символов для озвучки — %d",
+		"Translations in -speak-template are only known after the lookup and were counted as empty":         "Переводы в -speak-template известны только после запроса и посчитаны пустыми",
+		"Stopped early after %d words because of -limit":                                                    "Остановлено досрочно из-за -limit, записано слов: %d",
+		"Stopped early after %d words because the -deadline of %s passed":                                   "Остановлено досрочно: истёк срок -deadline (%[2]s), записано слов: %[1]d",
+		"Processing complete: %d of %d words written. Output written to %s":                                 "Обработка завершена, записано слов: %d из %d. Результат записан в %s",
+		"  %s: %d words read, %d written":                                                                   "  %s: прочитано слов — %d, записано — %d",
+		"Audio files saved to the '%s' directory":                                                           "Аудиофайлы сохранены в папку '%s'",
+		"Checked %d sound references in %s: %d missing or empty, %d files in '%s' not referenced":           "Проверено ссылок на звук в %[2]s: %[1]d. Отсутствуют или пусты: %[3]d, файлов в '%[5]s' без ссылок: %[4]d",
+		"  missing or empty: %s":          "  отсутствует или пуст: %s",
+		"  not referenced: %s":            "  без ссылок: %s",
+		"Skipped %d existing audio files": "Пропущено существующих аудиофайлов: %d",
+		"Audio was halted because the text-to-speech quota ran out: %d words were written without their audio files, create them with -only-missing-audio once the quota renews": "Озвучка остановлена: закончилась квота синтеза речи. Слов записано без аудиофайлов: %d, создайте их с -only-missing-audio после обновления квоты",
+		"%d words were translated from %s without a lookup": "Слов переведено по %[2]s без запроса: %[1]d",
+		"%d words failed and were left out of the output":   "Слов с ошибкой, не попавших в результат: %d",
+		"%d words had no translation":                       "Слов без перевода: %d",
+		"Deck bundled into %s":                              "Колода упакована в %s",
+	},
+}
+
+// UILanguages returns the supported interface languages, English first.
+func UILanguages() []string {
+	return append([]string{"en"}, slices.Sorted(maps.Keys(catalogs))...)
+}
+
+// Messages formats progress and summary lines in an interface language. A nil
+// *Messages formats them in English.
+type Messages struct {
+	catalog map[string]string
+}
+
+// NewMessages returns the messages of lang, one of UILanguages.
+func NewMessages(lang string) (*Messages, error) {
+	if lang == "en" {
+		return &Messages{}, nil
+	}
+	catalog, ok := catalogs[lang]
+	if !ok {
+		return nil, fmt.Errorf("unsupported interface language %q", lang)
+	}
+	return &Messages{catalog: catalog}, nil
+}
+
+// Sprintf formats the translation of the English format, or format itself
+// when it has none.
+func (m *Messages) Sprintf(format string, args ...any) string {
+	if m != nil {
+		if translated, ok := m.catalog[format]; ok {
+			format = translated
+		}
+	}
+	return fmt.Sprintf(format, args...)
+}
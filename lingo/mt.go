@@ -0,0 +1,193 @@
+package lingo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// TextTranslator machine-translates running text, such as definitions, which
+// a dictionary lookup can't.
+type TextTranslator interface {
+	// TranslateText returns the translations of texts from source to target
+	// (ISO 639-1 codes), in the same order.
+	TranslateText(texts []string, source, target string) ([]string, error)
+}
+
+// DefaultLibreTranslateURL is the public LibreTranslate endpoint.
+const DefaultLibreTranslateURL = "https://libretranslate.com/translate"
+
+// LibreTranslate translates text with a LibreTranslate-compatible API.
+type LibreTranslate struct {
+	client  *http.Client
+	baseURL string
+	apiKey  string // optional, self-hosted instances need none
+	logs    *Logger
+}
+
+// NewLibreTranslate returns a translator posting to baseURL, or
+// DefaultLibreTranslateURL when it is empty.
+func NewLibreTranslate(client *http.Client, baseURL, apiKey string, logs *Logger) *LibreTranslate {
+	if baseURL == "" {
+		baseURL = DefaultLibreTranslateURL
+	}
+	return &LibreTranslate{client: client, baseURL: baseURL, apiKey: apiKey, logs: logs}
+}
+
+// TranslateText sends all texts in a single request.
+func (t *LibreTranslate) TranslateText(texts []string, source, target string) ([]string, error) {
+	reqBody, err := json.Marshal(map[string]any{
+		"q":       texts,
+		"source":  source,
+		"target":  target,
+		"format":  "text",
+		"api_key": t.apiKey,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	t.logs.For("mt_request", "").Debugf("LibreTranslate request: POST %s %s-%s %q", t.baseURL, source, target, texts)
+	resp, err := t.client.Post(t.baseURL, "application/json", bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("translating text: %w", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+
+	var result struct {
+		TranslatedText []string `json:"translatedText"`
+		Error          string   `json:"error"`
+	}
+	if json.Unmarshal(body, &result) == nil && result.Error != "" {
+		return nil, fmt.Errorf("LibreTranslate API error: %d - %s", resp.StatusCode, result.Error)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("LibreTranslate API error: %d - %s", resp.StatusCode, truncateBody(body))
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("parsing JSON: %w", err)
+	}
+	if len(result.TranslatedText) != len(texts) {
+		return nil, fmt.Errorf("got %d translations for %d texts", len(result.TranslatedText), len(texts))
+	}
+	return result.TranslatedText, nil
+}
+
+// SplitSentences splits text after every ".", "!", "?" or "…" followed by
+// whitespace, so each sentence of a definition is translated, and cached, on
+// its own.
+func SplitSentences(text string) []string {
+	var sentences []string
+	start := 0
+	runes := []rune(text)
+	for i, r := range runes {
+		if strings.ContainsRune(".!?…", r) && i+1 < len(runes) && unicode.IsSpace(runes[i+1]) {
+			if s := strings.TrimSpace(string(runes[start : i+1])); s != "" {
+				sentences = append(sentences, s)
+			}
+			start = i + 1
+		}
+	}
+	if s := strings.TrimSpace(string(runes[start:])); s != "" {
+		sentences = append(sentences, s)
+	}
+	return sentences
+}
+
+// CachingTranslator remembers the translations of a TextTranslator in a JSON
+// file, so sentences repeated within a run or across runs are translated
+// once.
+type CachingTranslator struct {
+	TextTranslator
+	path string
+
+	mu      sync.Mutex
+	entries map[string]map[string]string // "source-target" -> text -> translation
+	changed bool
+}
+
+// NewCachingTranslator wraps t with the cache kept in path, which is created
+// by Save if it doesn't exist yet.
+func NewCachingTranslator(t TextTranslator, path string) (*CachingTranslator, error) {
+	c := &CachingTranslator{TextTranslator: t, path: path, entries: map[string]map[string]string{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &c.entries); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// TranslateText translates only the texts missing from the cache.
+func (c *CachingTranslator) TranslateText(texts []string, source, target string) ([]string, error) {
+	pair := source + "-" + target
+	result := make([]string, len(texts))
+	var missing []string
+	var positions []int
+	c.mu.Lock()
+	for i, text := range texts {
+		if translation, ok := c.entries[pair][text]; ok {
+			result[i] = translation
+		} else {
+			missing = append(missing, text)
+			positions = append(positions, i)
+		}
+	}
+	c.mu.Unlock()
+	if len(missing) == 0 {
+		return result, nil
+	}
+
+	translations, err := c.TextTranslator.TranslateText(missing, source, target)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries[pair] == nil {
+		c.entries[pair] = map[string]string{}
+	}
+	for i, translation := range translations {
+		result[positions[i]] = translation
+		c.entries[pair][missing[i]] = translation
+	}
+	c.changed = true
+	return result, nil
+}
+
+// Save writes the cache back to its file if anything was added.
+func (c *CachingTranslator) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.changed {
+		return nil
+	}
+	// Definitions often hold markup such as <br>, kept readable in the file.
+	var data bytes.Buffer
+	enc := json.NewEncoder(&data)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(c.entries); err != nil {
+		return err
+	}
+	if err := WriteFileAtomic(c.path, data.Bytes()); err != nil {
+		return err
+	}
+	c.changed = false
+	return nil
+}
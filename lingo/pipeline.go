@@ -0,0 +1,183 @@
+package lingo
+
+import (
+	"context"
+	"iter"
+	"sync"
+)
+
+// Result reports how an entry left Process.
+type Result struct {
+	Action string // step that failed, empty on success
+	Err    error
+}
+
+// Outcome is what a Process handler made of an entry.
+type Outcome int
+
+const (
+	// Kept entries count towards Config.Limit.
+	Kept Outcome = iota
+	// Dropped entries were left out after all, e.g. by a failed step after
+	// Process, and give their Limit slot to the next entry.
+	Dropped
+	// Stop stops feeding new entries into the pipeline.
+	Stop
+)
+
+// job is an entry on its way through the pipeline, with its position in
+// the input.
+type job struct {
+	index int
+	entry *Entry
+}
+
+// stageResult is a Result on its way through the pipeline.
+type stageResult struct {
+	job
+	Result
+	holdsSlot bool // the entry still takes up a Limit slot
+}
+
+// All returns the entries of a slice for Process.
+func All(entries []Entry) iter.Seq[*Entry] {
+	return func(yield func(*Entry) bool) {
+		for i := range entries {
+			if !yield(&entries[i]) {
+				return
+			}
+		}
+	}
+}
+
+// Process translates and voices entries in two concurrent stages, each with
+// its own pool of workers: lookups are cheap and fast while synthesis is slow,
+// so a word's audio can be generated while later words are being translated.
+//
+// handle is called for each entry in input order, buffering results that
+// finish early. Entries without a translation skip the audio stage in strict
+// mode. handle returns Stop to stop feeding new entries into the pipeline;
+// entries already in flight are finished but not handled. With a Limit, an
+// entry is only fed in while a slot is free; it gives its slot back unless it
+// is voiced and handle keeps it. Cancelling ctx also stops feeding entries,
+// and Process then returns ctx.Err().
+//
+// entries is only pulled as workers are free, so it may produce them while
+// they are read, e.g. row by row from a large workbook. Process has stopped
+// pulling by the time it returns.
+func (p *Processor) Process(ctx context.Context, entries iter.Seq[*Entry], handle func(e *Entry, r Result) Outcome) error {
+	stop := make(chan struct{})
+	jobs := make(chan job)
+	toAudio := make(chan job, p.cfg.AudioWorkers)
+	results := make(chan stageResult, p.cfg.TranslateWorkers+p.cfg.AudioWorkers)
+	var slots chan struct{}
+	if p.cfg.Limit > 0 {
+		slots = make(chan struct{}, p.cfg.Limit)
+	}
+	release := func() {
+		if slots != nil {
+			<-slots
+		}
+	}
+
+	go func() {
+		defer close(jobs)
+		i := 0
+		for e := range entries {
+			if slots != nil {
+				select {
+				case slots <- struct{}{}:
+				case <-stop:
+					return
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case jobs <- job{index: i, entry: e}:
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			}
+			i++
+		}
+	}()
+
+	var translating sync.WaitGroup
+	for range p.cfg.TranslateWorkers {
+		translating.Add(1)
+		go func() {
+			defer translating.Done()
+			for j := range jobs {
+				e := j.entry
+				p.cfg.Logs.For("word_started", e.Word).Infof("Processing word: %s", e.Word)
+				if err := p.Translate(e); err != nil {
+					release()
+					results <- stageResult{job: j, Result: Result{Action: "fetching translation", Err: err}}
+					continue
+				}
+				if p.cfg.Strict && e.Translation == "" {
+					release()
+					results <- stageResult{job: j}
+					continue
+				}
+				toAudio <- j
+			}
+		}()
+	}
+	go func() {
+		translating.Wait()
+		close(toAudio)
+	}()
+
+	var voicing sync.WaitGroup
+	for range p.cfg.AudioWorkers {
+		voicing.Add(1)
+		go func() {
+			defer voicing.Done()
+			for j := range toAudio {
+				// Generate audio with the configured TTS provider
+				if err := p.Voice(j.entry); err != nil {
+					release()
+					results <- stageResult{job: j, Result: Result{Action: "generating audio", Err: err}}
+					continue
+				}
+				results <- stageResult{job: j, holdsSlot: true}
+			}
+		}()
+	}
+	go func() {
+		voicing.Wait()
+		close(results)
+	}()
+
+	// Reorder results so output follows the input order.
+	pending := map[int]stageResult{}
+	next := 0
+	stopped := false
+	for r := range results {
+		pending[r.index] = r
+		for {
+			r, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			if stopped {
+				continue
+			}
+			switch handle(r.entry, r.Result) {
+			case Dropped:
+				if r.holdsSlot {
+					release()
+				}
+			case Stop:
+				stopped = true
+				close(stop)
+			}
+		}
+	}
+	return ctx.Err()
+}
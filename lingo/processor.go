@@ -0,0 +1,483 @@
+// Package lingo turns word lists into flashcard material: it looks every word
+// up in a bilingual dictionary and synthesizes its pronunciation, leaving the
+// choice of providers, input and output to the caller.
+package lingo
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// Entry is a single input word together with the results gathered for it
+// while processing.
+type Entry struct {
+	Seq        int    // position among all input words of the run
+	Source     string // input file the word was read from
+	Row        int    // 1-based spreadsheet row
+	Word       string
+	Term       string // form of the word used for lookup and audio
+	Definition string
+	// DefinitionTranslation is the machine translation of Definition, see
+	// Config.DefinitionTranslator.
+	DefinitionTranslation string
+	Translation           string
+	Pos                   string // part of speech of Translation
+	Dictionary            DictionaryEntry
+	Tags                  string    // space-separated Anki tags
+	Override              *Override // replaces the dictionary lookup when set
+	AudioFile             string    // audio file name within AudioSettings.Dir
+	// ExampleAudioFile holds the spoken Definition with
+	// AudioSettings.SpeakExample, empty when there is no definition.
+	ExampleAudioFile string
+	// ExampleAudioFiles maps the dictionary examples spoken in place of
+	// the definition with AudioSettings.Examples to their audio files.
+	ExampleAudioFiles map[string]string
+	Translated        bool
+	Voiced            bool
+	AudioReused       bool // Voiced with an audio file that already existed
+	// AudioPending is Voiced without creating the audio files because the
+	// TTS quota ran out; the entry keeps their names so -only-missing-audio
+	// can create them later.
+	AudioPending bool
+}
+
+// Override is a translation supplied in place of a dictionary lookup, for
+// words the dictionary gets wrong or doesn't know.
+type Override struct {
+	Translation string
+	SkipAudio   bool // leave the word without audio
+}
+
+// AudioSettings describes where audio files go, how they are named and what
+// text is synthesized.
+type AudioSettings struct {
+	Dir            string
+	Lang           string // language of the spoken words
+	ASCIIFilenames bool
+	Speak          *template.Template // optional, see ParseSpeakTemplate
+	MaxChars       int                // longest text to synthesize, 0 for no limit
+	SkipLong       bool               // reject longer text instead of truncating it
+	SpeakExample   bool               // also synthesize the definition into its own file
+	// Examples, when positive, makes SpeakExample speak up to this many
+	// dictionary examples, each into its own file, in place of the
+	// definition of a word that has any.
+	Examples int
+	// MediaDir, when set, receives a copy of every audio file, e.g. the
+	// collection.media folder of an Anki profile.
+	MediaDir string
+	// Verify regenerates existing audio files that fail AudioIntact instead
+	// of trusting them because they exist.
+	Verify bool
+	// HashFilenames names audio files by a hash of what is synthesized
+	// instead of by the word, see HashedAudioFile.
+	HashFilenames bool
+	// NameTemplate names audio files and the subdirectories they go to, see
+	// ParseAudioNameTemplate; empty names them after the word.
+	NameTemplate string
+	// Shared, when set, links audio that runs for other decks already made
+	// instead of synthesizing it again.
+	Shared *SharedAudio
+}
+
+// Config configures a Processor.
+type Config struct {
+	Dictionary DictionaryProvider
+	TTS        TTSProvider
+	// Logs receives progress messages; nil discards them.
+	Logs *Logger
+	// PartsOfSpeech are preferred, in order, when picking a translation.
+	PartsOfSpeech []string
+	Audio         AudioSettings
+	// Strict skips audio for words without a translation.
+	Strict bool
+	// TranslateWorkers and AudioWorkers size the concurrent stages of
+	// Process; values below 1 mean 1.
+	TranslateWorkers int
+	AudioWorkers     int
+	// Limit, when positive, is the most entries Process voices: entries are
+	// only fed in while fewer than Limit are in flight or voiced, so none is
+	// looked up or voiced past the limit.
+	Limit int
+	// DefinitionTranslator, when set, translates definitions into TargetLang
+	// along with the lookup of each word.
+	DefinitionTranslator TextTranslator
+	TargetLang           string
+}
+
+// Processor translates and voices entries with the providers of its Config.
+type Processor struct {
+	cfg Config
+}
+
+// NewProcessor returns a Processor for cfg.
+func NewProcessor(cfg Config) *Processor {
+	cfg.TranslateWorkers = max(cfg.TranslateWorkers, 1)
+	cfg.AudioWorkers = max(cfg.AudioWorkers, 1)
+	return &Processor{cfg: cfg}
+}
+
+// Translate looks up the entry's term and stores the result. An entry with
+// an Override takes its translation from there without a lookup.
+func (p *Processor) Translate(e *Entry) error {
+	if e.Override != nil {
+		p.ApplyDictionaryEntry(e, DictionaryEntry{Senses: []Sense{{Text: e.Override.Translation}}})
+		p.TranslateDefinition(e)
+		return nil
+	}
+	result, err := p.cfg.Dictionary.Lookup(e.Term)
+	if err != nil {
+		return err
+	}
+	p.ApplyDictionaryEntry(e, result)
+	p.TranslateDefinition(e)
+	return nil
+}
+
+// TranslateDefinition machine-translates e's definition sentence by sentence
+// when Config.DefinitionTranslator is set. A failure only costs the
+// translated definition, so it is logged rather than failing the word.
+func (p *Processor) TranslateDefinition(e *Entry) {
+	if p.cfg.DefinitionTranslator == nil || strings.TrimSpace(e.Definition) == "" {
+		return
+	}
+	translated, err := p.cfg.DefinitionTranslator.TranslateText(SplitSentences(e.Definition), p.spokenLang(e), p.cfg.TargetLang)
+	if err != nil {
+		p.cfg.Logs.For("definition_translation_failed", e.Word).Warnf("translating the definition of %s failed: %v", e.Word, err)
+		return
+	}
+	e.DefinitionTranslation = strings.Join(translated, " ")
+}
+
+// ApplyDictionaryEntry stores a lookup result on e, picking the first
+// translation or, with PartsOfSpeech set, the first one with a matching part
+// of speech. It lets callers reuse lookups made earlier.
+func (p *Processor) ApplyDictionaryEntry(e *Entry, result DictionaryEntry) {
+	pos := p.cfg.PartsOfSpeech
+	e.Dictionary = result
+	e.Translation, e.Pos = "", ""
+
+	// Retrieve the first translation from the result, if available.
+	if len(pos) == 0 {
+		var ok bool
+		if e.Translation, ok = firstTranslation(result); ok {
+			e.Pos = result.Senses[0].Pos
+		}
+	} else {
+		sense, matched, ok := preferredTranslation(result, pos)
+		if ok && !matched {
+			p.cfg.Logs.For("pos_fallback", e.Word).Infof("No %s translation for %s, using the first one", strings.Join(pos, "/"), e.Word)
+		}
+		e.Translation, e.Pos = sense.Text, sense.Pos
+	}
+	e.Translated = true
+}
+
+// Voice generates audio for the entry unless its file already exists or its
+// Override skips audio.
+func (p *Processor) Voice(e *Entry) error {
+	audio, logs := p.cfg.Audio, p.cfg.Logs
+	if e.Override != nil && e.Override.SkipAudio {
+		e.AudioFile = ""
+		e.Voiced = true
+		return nil
+	}
+
+	text, err := p.SpeakText(e)
+	if err != nil {
+		return err
+	}
+	p.nameAudioFile(e, text)
+	audioPath := filepath.Join(audio.Dir, e.AudioFile)
+
+	// Check if audio file already exists, generate only if needed
+	if p.needsAudio(audioPath, e.Word) {
+		if err := p.synthesize(audioPath, text, e); errors.Is(err, ErrQuotaExceeded) {
+			p.pendAudio(e)
+			return nil
+		} else if err != nil {
+			return err
+		}
+		logs.For("audio_created", e.Word).Infof("Created audio file for: %s", e.Word)
+	} else {
+		logs.For("audio_reused", e.Word).Verbosef("Audio file for %s already exists, skipping generation", e.Word)
+		e.AudioReused = true
+	}
+	if err := p.copyToMedia(e.AudioFile); err != nil {
+		return err
+	}
+	if err := p.voiceExample(e); errors.Is(err, ErrQuotaExceeded) {
+		p.pendAudio(e)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	e.Voiced = true
+	return nil
+}
+
+// pendAudio marks e as voiced once the TTS quota ran out, naming its example
+// audio file too so the output references every file still to be created.
+func (p *Processor) pendAudio(e *Entry) {
+	if examples := p.spokenExamples(e); len(examples) > 0 {
+		for _, example := range examples {
+			p.nameExampleAudioFile(e, example)
+		}
+	} else if p.cfg.Audio.SpeakExample && e.Definition != "" && e.ExampleAudioFile == "" {
+		e.ExampleAudioFile = p.exampleAudioFile(e, e.Definition)
+	}
+	e.Voiced, e.AudioPending = true, true
+}
+
+// PlannedSynthesis returns the texts Voice would synthesize for e given the
+// audio files currently on disk, without calling any provider. Speak templates
+// see the translation e has so far, which is empty before the lookup.
+func (p *Processor) PlannedSynthesis(e *Entry) ([]string, error) {
+	audio := p.cfg.Audio
+	if e.Override != nil && e.Override.SkipAudio {
+		return nil, nil
+	}
+	text, err := p.SpeakText(e)
+	if err != nil {
+		return nil, err
+	}
+	p.nameAudioFile(e, text)
+	var texts []string
+	if p.needsAudio(filepath.Join(audio.Dir, e.AudioFile), e.Word) {
+		texts = append(texts, text)
+	}
+	if examples := p.spokenExamples(e); len(examples) > 0 {
+		for _, example := range examples {
+			if p.needsAudio(filepath.Join(audio.Dir, p.exampleAudioFile(e, example)), e.Word) {
+				texts = append(texts, example)
+			}
+		}
+	} else if audio.SpeakExample && e.Definition != "" && p.needsAudio(filepath.Join(audio.Dir, p.exampleAudioFile(e, e.Definition)), e.Word) {
+		texts = append(texts, e.Definition)
+	}
+	for i, text := range texts {
+		text, err := limitSpeakText(text, audio, nil, e.Word)
+		if err != nil {
+			return nil, err
+		}
+		texts[i] = text
+	}
+	return texts, nil
+}
+
+// SpeakText returns the text synthesized for e's word: the expanded speak
+// template, or the term itself.
+func (p *Processor) SpeakText(e *Entry) (string, error) {
+	text, err := speakText(p.cfg.Audio.Speak, speakData{Word: e.Term, Definition: e.Definition, Translation: e.Translation})
+	if err != nil {
+		return "", fmt.Errorf("expanding speak template: %w", err)
+	}
+	return text, nil
+}
+
+// HashedAudioFile returns the content-addressed name of the audio of text
+// spoken for e. It hashes the text, its language and the TTS fingerprint, so
+// equal requests share a file and different ones never collide.
+func (p *Processor) HashedAudioFile(e *Entry, text string) string {
+	return p.audioHash(e, text) + "." + p.cfg.TTS.Extension()
+}
+
+// audioHash returns the hash HashedAudioFile names the audio of text by.
+func (p *Processor) audioHash(e *Entry, text string) string {
+	return synthesisKey(p.cfg.TTS, text, p.spokenLang(e))[:16]
+}
+
+// nameAudioFile sets the name used for e's audio file and [sound:...] field,
+// a path relative to AudioSettings.Dir. Word-based names are normally
+// assigned up front by AssignAudioFiles so that colliding names get distinct
+// files; hashed names, and the {lang} and {hash} placeholders of
+// AudioSettings.NameTemplate, depend on the lookup and the text.
+func (p *Processor) nameAudioFile(e *Entry, text string) {
+	audio := p.cfg.Audio
+	switch {
+	case audio.HashFilenames:
+		e.AudioFile = p.HashedAudioFile(e, text)
+	case e.AudioFile == "":
+		e.AudioFile = fmt.Sprintf("%s.%s", expandAudioName(audio.NameTemplate, SanitizeFilename(e.Term, audio.ASCIIFilenames), e.Seq+1), p.cfg.TTS.Extension())
+	}
+	if audio.NameTemplate != "" {
+		e.AudioFile = strings.NewReplacer("{lang}", SanitizeFilename(p.spokenLang(e), true), "{hash}", p.audioHash(e, text)).Replace(e.AudioFile)
+	}
+}
+
+// exampleAudioFile returns the name of the audio file for sentence, e's
+// definition or one of its dictionary examples.
+func (p *Processor) exampleAudioFile(e *Entry, sentence string) string {
+	if p.cfg.Audio.HashFilenames {
+		return p.HashedAudioFile(e, sentence)
+	}
+	return ExampleAudioFile(e.AudioFile, sentence)
+}
+
+// spokenExamples returns the dictionary examples SpeakExample speaks for e
+// with AudioSettings.Examples, none when the definition is spoken instead.
+func (p *Processor) spokenExamples(e *Entry) []string {
+	audio := p.cfg.Audio
+	if !audio.SpeakExample || audio.Examples <= 0 {
+		return nil
+	}
+	return ExampleSentences(e.Dictionary, audio.Examples)
+}
+
+// nameExampleAudioFile records the name of the audio file for one of e's
+// dictionary examples in e.ExampleAudioFiles and returns it.
+func (p *Processor) nameExampleAudioFile(e *Entry, example string) string {
+	if e.ExampleAudioFiles == nil {
+		e.ExampleAudioFiles = map[string]string{}
+	}
+	name := p.exampleAudioFile(e, example)
+	e.ExampleAudioFiles[example] = name
+	return name
+}
+
+// voiceExample generates audio for the entry's definition when
+// AudioSettings.SpeakExample is set and there is a definition to speak, or
+// for each of its dictionary examples with AudioSettings.Examples.
+func (p *Processor) voiceExample(e *Entry) error {
+	audio := p.cfg.Audio
+	if examples := p.spokenExamples(e); len(examples) > 0 {
+		for _, example := range examples {
+			if err := p.voiceSentence(e, example, p.nameExampleAudioFile(e, example)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if !audio.SpeakExample || e.Definition == "" {
+		return nil
+	}
+	if e.ExampleAudioFile == "" {
+		e.ExampleAudioFile = p.exampleAudioFile(e, e.Definition)
+	}
+	return p.voiceSentence(e, e.Definition, e.ExampleAudioFile)
+}
+
+// voiceSentence generates the audio file name for an example sentence of e
+// unless it already exists.
+func (p *Processor) voiceSentence(e *Entry, sentence, name string) error {
+	audio, logs := p.cfg.Audio, p.cfg.Logs
+	audioPath := filepath.Join(audio.Dir, name)
+	if p.needsAudio(audioPath, e.Word) {
+		if err := p.synthesize(audioPath, sentence, e); err != nil {
+			return fmt.Errorf("example sentence: %w", err)
+		}
+		logs.For("example_audio_created", e.Word).Infof("Created example audio file for: %s", e.Word)
+	} else {
+		logs.For("example_audio_reused", e.Word).Verbosef("Example audio file for %s already exists, skipping generation", e.Word)
+	}
+	return p.copyToMedia(name)
+}
+
+// needsAudio reports whether the audio file at audioPath has to be
+// generated: it is missing or, with AudioSettings.Verify, broken.
+func (p *Processor) needsAudio(audioPath, word string) bool {
+	if _, err := os.Stat(audioPath); os.IsNotExist(err) {
+		return true
+	}
+	if p.cfg.Audio.Verify && !AudioIntact(audioPath) {
+		p.cfg.Logs.For("audio_corrupt", word).Warnf("%s is empty or not valid audio, regenerating it", audioPath)
+		return true
+	}
+	return false
+}
+
+// copyToMedia copies the named audio file into AudioSettings.MediaDir unless
+// it is already there. Anki resolves [sound:...] references relative to
+// that folder, which is flat, so names never have subdirectories here.
+func (p *Processor) copyToMedia(name string) error {
+	audio := p.cfg.Audio
+	if audio.MediaDir == "" {
+		return nil
+	}
+	target := filepath.Join(audio.MediaDir, name)
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		return nil
+	}
+	data, err := os.ReadFile(filepath.Join(audio.Dir, name))
+	if err != nil {
+		return fmt.Errorf("copying audio to media folder: %w", err)
+	}
+	if err := WriteFileAtomic(target, data); err != nil {
+		return fmt.Errorf("copying audio to media folder: %w", err)
+	}
+	return nil
+}
+
+// spokenLang returns the language e's word is spoken in: the one detected
+// during lookup, or AudioSettings.Lang.
+func (p *Processor) spokenLang(e *Entry) string {
+	if e.Dictionary.Lang != "" {
+		return e.Dictionary.Lang
+	}
+	return p.cfg.Audio.Lang
+}
+
+// synthesize speaks text for e, limited to AudioSettings.MaxChars, into
+// audioPath.
+func (p *Processor) synthesize(audioPath, text string, e *Entry) error {
+	text, err := limitSpeakText(text, p.cfg.Audio, p.cfg.Logs, e.Word)
+	if err != nil {
+		return err
+	}
+	lang, shared := p.spokenLang(e), p.cfg.Audio.Shared
+	if shared != nil && shared.Link(p.cfg.TTS, text, lang, audioPath) {
+		return nil
+	}
+	data, err := p.cfg.TTS.Synthesize(text, lang)
+	if err != nil {
+		return err
+	}
+	if err := saveAudio(audioPath, data); err != nil {
+		return err
+	}
+	if shared != nil {
+		shared.Record(p.cfg.TTS, text, lang, audioPath)
+	}
+	return nil
+}
+
+// saveAudio writes an audio file, first recreating its directory in case it
+// was removed during the run.
+func saveAudio(audioPath string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(audioPath), 0755); err != nil {
+		return fmt.Errorf("creating audio directory: %w", err)
+	}
+	if err := WriteFileAtomic(audioPath, data); err != nil {
+		return fmt.Errorf("saving audio file: %w", err)
+	}
+	return nil
+}
+
+// WriteFileAtomic writes data to a temporary file next to path and renames it
+// into place only once it is fully written, so path never holds a partial file.
+func WriteFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
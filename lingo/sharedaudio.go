@@ -0,0 +1,170 @@
+package lingo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SharedAudio is a manifest, shared by the runs for any number of decks, of
+// where the audio of each synthesis request already lives. A run that needs
+// the same audio links the recorded file into its own audio directory
+// instead of synthesizing it again. Unlike CachingTTS it keeps no copies of
+// its own: it only points at the files runs have written.
+//
+// An entry goes stale when its file is deleted or replaced, which is noticed
+// by its size and modification time; stale entries are dropped and the audio
+// is synthesized again. It is safe for concurrent use.
+type SharedAudio struct {
+	path string
+	logs *Logger
+
+	mu    sync.Mutex
+	files map[string]sharedAudioFile // synthesis key -> file
+	// added and stale are this run's changes, merged into the manifest on
+	// disk so saving keeps what other runs recorded meanwhile.
+	added map[string]sharedAudioFile
+	stale map[string]sharedAudioFile
+}
+
+// sharedAudioFile is an audio file recorded in a SharedAudio manifest.
+type sharedAudioFile struct {
+	Path    string    `json:"path"` // absolute
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// same reports whether f and g record the same file, as it was then.
+func (f sharedAudioFile) same(g sharedAudioFile) bool {
+	return f.Path == g.Path && f.Size == g.Size && f.ModTime.Equal(g.ModTime)
+}
+
+// OpenSharedAudio reads the manifest at path, which is created on the first
+// Record if it doesn't exist yet.
+func OpenSharedAudio(path string, logs *Logger) (*SharedAudio, error) {
+	files, err := readSharedAudio(path)
+	if err != nil {
+		return nil, err
+	}
+	return &SharedAudio{path: path, logs: logs, files: files, added: map[string]sharedAudioFile{}, stale: map[string]sharedAudioFile{}}, nil
+}
+
+// readSharedAudio reads the entries of the manifest at path.
+func readSharedAudio(path string) (map[string]sharedAudioFile, error) {
+	files := map[string]sharedAudioFile{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return files, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &files); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return files, nil
+}
+
+// Link places the audio recorded for the synthesis of text in lang at
+// audioPath, as a hard link or, across filesystems, a copy. It reports false
+// when there is no usable recorded file.
+func (s *SharedAudio) Link(tts TTSProvider, text, lang, audioPath string) bool {
+	key := synthesisKey(tts, text, lang)
+	s.mu.Lock()
+	file, ok := s.files[key]
+	s.mu.Unlock()
+	if !ok {
+		return false
+	}
+	info, err := os.Stat(file.Path)
+	if err != nil || info.Size() != file.Size || !info.ModTime().Equal(file.ModTime) {
+		s.logs.For("shared_audio_stale", "").Verbosef("%s was deleted or replaced, synthesizing %q again", file.Path, text)
+		s.mu.Lock()
+		delete(s.files, key)
+		delete(s.added, key)
+		s.stale[key] = file
+		s.mu.Unlock()
+		s.save()
+		return false
+	}
+
+	if err := linkAudio(file.Path, audioPath); err != nil {
+		s.logs.Warnf("reusing shared audio %s: %v", file.Path, err)
+		return false
+	}
+	s.logs.For("shared_audio_linked", "").Verbosef("Reusing %s for %q", file.Path, text)
+	return true
+}
+
+// linkAudio makes audioPath hold the file at src, replacing a broken file
+// left there.
+func linkAudio(src, audioPath string) error {
+	if err := os.MkdirAll(filepath.Dir(audioPath), 0755); err != nil {
+		return err
+	}
+	if err := os.Remove(audioPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if os.Link(src, audioPath) == nil {
+		return nil
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(audioPath, data)
+}
+
+// Record notes that audioPath holds the audio of text in lang and saves the
+// manifest. Failures only cost a synthesis later, so they are logged rather
+// than returned.
+func (s *SharedAudio) Record(tts TTSProvider, text, lang, audioPath string) {
+	path, err := filepath.Abs(audioPath)
+	if err != nil {
+		s.logs.Warnf("recording shared audio: %v", err)
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		s.logs.Warnf("recording shared audio: %v", err)
+		return
+	}
+	key := synthesisKey(tts, text, lang)
+	file := sharedAudioFile{Path: path, Size: info.Size(), ModTime: info.ModTime()}
+	s.mu.Lock()
+	s.files[key] = file
+	s.added[key] = file
+	s.mu.Unlock()
+	s.save()
+}
+
+// save merges this run's changes into the manifest on disk, so runs sharing
+// it at the same time don't drop each other's entries.
+func (s *SharedAudio) save() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files, err := readSharedAudio(s.path)
+	if err != nil {
+		s.logs.Warnf("saving shared audio manifest: %v", err)
+		return
+	}
+	for key, file := range s.stale {
+		if current, ok := files[key]; ok && current.same(file) {
+			delete(files, key)
+		}
+	}
+	for key, file := range s.added {
+		files[key] = file
+	}
+	data, err := json.MarshalIndent(files, "", "  ")
+	if err == nil {
+		err = WriteFileAtomic(s.path, data)
+	}
+	if err != nil {
+		s.logs.Warnf("saving shared audio manifest: %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package lingo
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+)
+
+// speakData holds the values a speak template can refer to.
+type speakData struct {
+	Word        string
+	Definition  string
+	Translation string
+}
+
+// speakPlaceholders maps the shorthand placeholders accepted in a
+// speak template to the template actions they stand for.
+var speakPlaceholders = strings.NewReplacer(
+	"{word}", "{{.Word}}",
+	"{definition}", "{{.Definition}}",
+	"{translation}", "{{.Translation}}",
+)
+
+// ParseSpeakTemplate compiles the text synthesized for each word. Besides the {word},
+// {definition} and {translation} shorthands, full text/template syntax such as
+// {{if .Translation}} is accepted.
+func ParseSpeakTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("speak").Option("missingkey=error").Parse(speakPlaceholders.Replace(text))
+	if err != nil {
+		return nil, err
+	}
+	// Executing once catches references to unknown fields up front.
+	if err := tmpl.Execute(io.Discard, speakData{}); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// speakText returns the text to synthesize for data: the expanded template,
+// or just the word when no template is set.
+func speakText(tmpl *template.Template, data speakData) (string, error) {
+	if tmpl == nil {
+		return data.Word, nil
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// TruncateText cuts text to at most max characters, at the last word boundary
+// within the limit when there is one.
+func TruncateText(text string, max int) string {
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+	cut := 0
+	for i := 0; i < max; i++ {
+		_, size := utf8.DecodeRuneInString(text[cut:])
+		cut += size
+	}
+	truncated := text[:cut]
+	if next, _ := utf8.DecodeRuneInString(text[cut:]); !unicode.IsSpace(next) {
+		if i := strings.LastIndexFunc(truncated, unicode.IsSpace); i > 0 {
+			truncated = truncated[:i]
+		}
+	}
+	return strings.TrimSpace(truncated)
+}
+
+// limitSpeakText enforces audio.MaxChars on text. Over-length text is cut at
+// the last word boundary within the limit or, with audio.SkipLong, rejected.
+func limitSpeakText(text string, audio AudioSettings, logs *Logger, word string) (string, error) {
+	n := utf8.RuneCountInString(text)
+	if audio.MaxChars <= 0 || n <= audio.MaxChars {
+		return text, nil
+	}
+	if audio.SkipLong {
+		return "", fmt.Errorf("text to synthesize has %d characters, more than the limit of %d", n, audio.MaxChars)
+	}
+
+	truncated := TruncateText(text, audio.MaxChars)
+	logs.For("text_truncated", word).Warnf("text to synthesize for %s has %d characters, truncated to %d", word, n, utf8.RuneCountInString(truncated))
+	return truncated, nil
+}
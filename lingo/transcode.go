@@ -0,0 +1,71 @@
+package lingo
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// ffmpegFormats maps audio file extensions to the ffmpeg muxer writing them.
+var ffmpegFormats = map[string]string{
+	"mp3":  "mp3",
+	"wav":  "wav",
+	"opus": "opus",
+}
+
+// TranscodingTTS passes the audio of the wrapped provider through ffmpeg,
+// downmixing it to mono and re-encoding it at a lower bitrate or sample rate
+// to keep decks small.
+type TranscodingTTS struct {
+	TTSProvider
+	binary     string
+	format     string
+	bitrate    string // e.g. "64k", empty to keep the encoder default
+	sampleRate int    // in Hz, 0 to keep the input rate
+}
+
+// NewTranscodingTTS locates ffmpeg on the PATH and wraps tts. It fails when
+// ffmpeg is missing or cannot write tts's audio format, so callers can carry
+// on without it.
+func NewTranscodingTTS(tts TTSProvider, bitrate string, sampleRate int) (*TranscodingTTS, error) {
+	format, ok := ffmpegFormats[tts.Extension()]
+	if !ok {
+		return nil, fmt.Errorf("cannot transcode %s audio", tts.Extension())
+	}
+	path, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg not found in PATH")
+	}
+	return &TranscodingTTS{TTSProvider: tts, binary: path, format: format, bitrate: bitrate, sampleRate: sampleRate}, nil
+}
+
+func (t *TranscodingTTS) Fingerprint() string {
+	return fmt.Sprintf("%s|mono|%s|%d", t.TTSProvider.Fingerprint(), t.bitrate, t.sampleRate)
+}
+
+func (t *TranscodingTTS) Synthesize(text, lang string) ([]byte, error) {
+	audio, err := t.TTSProvider.Synthesize(text, lang)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"-hide_banner", "-loglevel", "error", "-i", "pipe:0", "-ac", "1"}
+	if t.sampleRate > 0 {
+		args = append(args, "-ar", strconv.Itoa(t.sampleRate))
+	}
+	if t.bitrate != "" {
+		args = append(args, "-b:a", t.bitrate)
+	}
+	args = append(args, "-f", t.format, "pipe:1")
+
+	cmd := exec.Command(t.binary, args...)
+	cmd.Stdin = bytes.NewReader(audio)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("transcoding audio: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
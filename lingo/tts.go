@@ -0,0 +1,62 @@
+package lingo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// TTSProvider turns text into audio. Implementations return the encoded audio
+// bytes; callers take care of naming and storing the files.
+type TTSProvider interface {
+	// Synthesize returns audio for text spoken in lang (an ISO 639-1 code).
+	Synthesize(text, lang string) ([]byte, error)
+	// Extension returns the file extension of the audio Synthesize produces.
+	Extension() string
+	// Fingerprint identifies the voice, model and output settings, so cached
+	// audio is only reused for requests that would produce the same bytes.
+	Fingerprint() string
+}
+
+// ErrQuotaExceeded is returned by a TTSProvider whose account has used up its
+// characters. Unlike other failures it will not clear up during the run.
+var ErrQuotaExceeded = errors.New("text-to-speech quota exceeded")
+
+// EspeakTTS synthesizes speech offline with espeak-ng or espeak.
+type EspeakTTS struct {
+	binary string
+}
+
+// NewEspeakTTS locates an espeak binary on the PATH.
+func NewEspeakTTS() (*EspeakTTS, error) {
+	for _, name := range []string{"espeak-ng", "espeak"} {
+		if path, err := exec.LookPath(name); err == nil {
+			return &EspeakTTS{binary: path}, nil
+		}
+	}
+	return nil, fmt.Errorf("neither espeak-ng nor espeak found in PATH")
+}
+
+func (e *EspeakTTS) Extension() string {
+	return "wav"
+}
+
+func (e *EspeakTTS) Fingerprint() string {
+	return "espeak|" + e.binary
+}
+
+// Synthesize runs espeak on text. The text goes in on stdin rather than as
+// an argument, so a word starting with a dash can't pass for an option.
+func (e *EspeakTTS) Synthesize(text, lang string) ([]byte, error) {
+	cmd := exec.Command(e.binary, "-v", lang, "--stdout", "--stdin")
+	cmd.Stdin = strings.NewReader(text)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("running %s: %w: %s", e.binary, err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
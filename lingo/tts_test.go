@@ -0,0 +1,24 @@
+package lingo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEspeakSynthesizeOptionLikeText(t *testing.T) {
+	// A stand-in espeak writes its arguments and then its input.
+	binary := filepath.Join(t.TempDir(), "espeak")
+	script := "#!/bin/sh\necho \"$@\"\ncat\n"
+	if err := os.WriteFile(binary, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	e := &EspeakTTS{binary: binary}
+	out, err := e.Synthesize("-w /tmp/overwritten.wav", "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "-v en --stdout --stdin\n-w /tmp/overwritten.wav"; string(out) != want {
+		t.Errorf("espeak got %q, want %q", out, want)
+	}
+}
@@ -0,0 +1,57 @@
+package lingo
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"unicode/utf8"
+)
+
+// Usage tallies the API calls a run makes so their cost can be reported.
+// It is safe for concurrent use.
+type Usage struct {
+	mu               sync.Mutex
+	lookups          int
+	synthesisCalls   int
+	synthesizedChars int
+}
+
+// CountingDictionary counts lookups made through the wrapped provider.
+type CountingDictionary struct {
+	DictionaryProvider
+	Usage *Usage
+}
+
+func (c CountingDictionary) Lookup(word string) (DictionaryEntry, error) {
+	c.Usage.mu.Lock()
+	c.Usage.lookups++
+	c.Usage.mu.Unlock()
+	return c.DictionaryProvider.Lookup(word)
+}
+
+// CountingTTS counts the characters sent to the wrapped provider. Audio that
+// already exists on disk never reaches it, so cache hits cost nothing.
+type CountingTTS struct {
+	TTSProvider
+	Usage *Usage
+}
+
+func (c CountingTTS) Synthesize(text, lang string) ([]byte, error) {
+	c.Usage.mu.Lock()
+	c.Usage.synthesisCalls++
+	c.Usage.synthesizedChars += utf8.RuneCountInString(text)
+	c.Usage.mu.Unlock()
+	return c.TTSProvider.Synthesize(text, lang)
+}
+
+// Report prints the usage summary, with an estimated cost when pricePer1000
+// (the price of 1000 synthesized characters) is set.
+func (u *Usage) Report(w io.Writer, pricePer1000 float64, m *Messages) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	fmt.Fprintln(w, m.Sprintf("API usage: %d translation lookups, %d synthesis requests, %d characters synthesized",
+		u.lookups, u.synthesisCalls, u.synthesizedChars))
+	if pricePer1000 > 0 {
+		fmt.Fprintln(w, m.Sprintf("Estimated synthesis cost: %.2f", float64(u.synthesizedChars)/1000*pricePer1000))
+	}
+}
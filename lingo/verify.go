@@ -0,0 +1,38 @@
+package lingo
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// AudioIntact reports whether the audio file at path looks complete enough to
+// keep: it is not empty and, for formats with a recognisable header (mp3, wav
+// and opus), starts with one. A file cut short by a crash usually fails, but
+// a truncated mp3 with an intact header still passes.
+func AudioIntact(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	header := make([]byte, 12)
+	n, _ := io.ReadFull(f, header)
+	header = header[:n]
+	if n == 0 {
+		return false
+	}
+	switch strings.ToLower(strings.TrimPrefix(filepath.Ext(path), ".")) {
+	case "mp3":
+		// An ID3 tag or an MPEG frame sync.
+		return bytes.HasPrefix(header, []byte("ID3")) || (n >= 2 && header[0] == 0xFF && header[1]&0xE0 == 0xE0)
+	case "wav":
+		return n == 12 && bytes.HasPrefix(header, []byte("RIFF")) && bytes.Equal(header[8:12], []byte("WAVE"))
+	case "opus":
+		return bytes.HasPrefix(header, []byte("OggS"))
+	}
+	return true
+}
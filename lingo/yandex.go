@@ -0,0 +1,272 @@
+package lingo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DicResult represents the structure of the Yandex.Dictionary API JSON response.
+type DicResult struct {
+	Head any          `json:"head"`
+	Def  []Definition `json:"def"`
+}
+
+type Definition struct {
+	Text string        `json:"text"`
+	Pos  string        `json:"pos"`
+	Ts   string        `json:"ts,omitempty"` // transcription of Text, not always present
+	Tr   []Translation `json:"tr"`
+}
+
+type Translation struct {
+	Text string    `json:"text"`
+	Pos  string    `json:"pos"`
+	Fr   int       `json:"fr,omitempty"` // frequency from 1 (rare) to 10 (common)
+	Syn  []Synonym `json:"syn,omitempty"`
+	Mean []Meaning `json:"mean,omitempty"`
+	Ex   []Example `json:"ex,omitempty"`
+}
+
+type Synonym struct {
+	Text string `json:"text"`
+}
+
+type Meaning struct {
+	Text string `json:"text"`
+}
+
+type Example struct {
+	Text string        `json:"text"`
+	Tr   []Translation `json:"tr"`
+}
+
+// yandexAPIError is the error object Yandex.Dictionary returns instead of a
+// result, e.g. for an invalid key (401), a blocked key (402) or an exceeded
+// daily limit (403).
+type yandexAPIError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *yandexAPIError) Error() string {
+	return fmt.Sprintf("Yandex API error %d: %s", e.Code, e.Message)
+}
+
+// DefaultYandexBaseURL is the public Yandex.Dictionary lookup endpoint.
+const DefaultYandexBaseURL = "https://dictionary.yandex.net/api/v1/dicservice.json/lookup"
+
+// Bits of the flags lookup parameter, see YandexFlagsUsage.
+const (
+	YandexFamilyFilter = 0x1 // leave out offensive translations
+	YandexShortPos     = 0x2 // abbreviate parts of speech, e.g. "n" for noun
+	YandexMorpho       = 0x4 // also find the word by its inflected forms
+	YandexPosFilter    = 0x8 // only translations of the word's part of speech
+)
+
+// YandexFlagsUsage describes the supported flag bits for usage messages.
+const YandexFlagsUsage = "1 family filter, 2 short parts of speech, 4 search by word forms, 8 same part of speech only"
+
+// YandexDictionary looks words up in the Yandex.Dictionary API.
+type YandexDictionary struct {
+	client  *http.Client
+	baseURL string
+	apiKey  string
+	lang    string
+	flags   int
+	logs    *Logger
+
+	langsOnce sync.Once
+	langs     []string
+	langsErr  error
+}
+
+// NewYandexDictionary returns a dictionary translating along lang, a Yandex
+// language pair such as "en-ru", sending flags, a combination of the Yandex*
+// flag bits, with every lookup. An empty baseURL selects
+// DefaultYandexBaseURL.
+func NewYandexDictionary(client *http.Client, baseURL, apiKey, lang string, flags int, logs *Logger) *YandexDictionary {
+	if baseURL == "" {
+		baseURL = DefaultYandexBaseURL
+	}
+	return &YandexDictionary{client: client, baseURL: baseURL, apiKey: apiKey, lang: lang, flags: flags, logs: logs}
+}
+
+// Langs returns the language pairs Yandex.Dictionary supports, such as
+// "en-ru". The list is fetched once and reused afterwards.
+func (y *YandexDictionary) Langs() ([]string, error) {
+	y.langsOnce.Do(func() {
+		y.langs, y.langsErr = y.fetchLangs()
+	})
+	return y.langs, y.langsErr
+}
+
+// fetchLangs requests the getLangs endpoint next to the lookup one.
+func (y *YandexDictionary) fetchLangs() ([]string, error) {
+	u, err := url.Parse(y.baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing base URL: %w", err)
+	}
+	u.Path = path.Join(path.Dir(u.Path), "getLangs")
+	u.RawQuery = url.Values{"key": {y.apiKey}}.Encode()
+	y.logs.For("langs_request", "").Debugf("Yandex getLangs: %s", strings.Replace(u.String(), url.QueryEscape(y.apiKey), "REDACTED", 1))
+
+	resp, err := y.client.Get(u.String())
+	if err != nil {
+		return nil, fmt.Errorf("fetching language pairs: %w", redactKey(err))
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+
+	var apiErr yandexAPIError
+	if json.Unmarshal(body, &apiErr) == nil && apiErr.Code != 0 && apiErr.Code != http.StatusOK {
+		return nil, &apiErr
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Yandex API error: %d - %s", resp.StatusCode, truncateBody(body))
+	}
+	var langs []string
+	if err := json.Unmarshal(body, &langs); err != nil {
+		return nil, fmt.Errorf("parsing JSON: %w", err)
+	}
+	return langs, nil
+}
+
+// CheckLangs verifies that Yandex.Dictionary supports every pair, so a
+// misconfigured pair fails up front instead of once per word.
+func (y *YandexDictionary) CheckLangs(pairs ...string) error {
+	langs, err := y.Langs()
+	if err != nil {
+		return err
+	}
+	for _, pair := range pairs {
+		if !slices.Contains(langs, pair) {
+			return fmt.Errorf("language pair %s is not supported; supported pairs: %s", pair, strings.Join(langs, ", "))
+		}
+	}
+	return nil
+}
+
+// buildLookupURL returns the Yandex.Dictionary lookup URL for text with every
+// query parameter percent-encoded. Zero flags are left out.
+func buildLookupURL(baseURL, apiKey, lang, text string, flags int) string {
+	params := url.Values{}
+	params.Set("key", apiKey)
+	params.Set("lang", lang)
+	params.Set("text", text)
+	if flags != 0 {
+		params.Set("flags", strconv.Itoa(flags))
+	}
+	return baseURL + "?" + params.Encode()
+}
+
+// redactKey hides the API key in the URL a failed request reports, so it
+// doesn't end up in the log or the failures file.
+func redactKey(err error) error {
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return err
+	}
+	u, parseErr := url.Parse(urlErr.URL)
+	if parseErr != nil {
+		urlErr.URL = "REDACTED"
+		return err
+	}
+	if query := u.Query(); query.Has("key") {
+		query.Set("key", "REDACTED")
+		u.RawQuery = query.Encode()
+	}
+	urlErr.URL = u.String()
+	return err
+}
+
+// Lookup fetches the dictionary entry for word.
+func (y *YandexDictionary) Lookup(word string) (DictionaryEntry, error) {
+	result, err := y.fetch(word)
+	if err != nil {
+		return DictionaryEntry{}, err
+	}
+	return result.entry(), nil
+}
+
+// entry converts the Yandex response into a DictionaryEntry, flattening the
+// translations of all definitions in response order. A translation with empty
+// text falls back to its first synonym and is dropped if it has none; the
+// others are ranked by their place in their definition. The transcription is
+// taken from the first definition that has one.
+func (r DicResult) entry() DictionaryEntry {
+	var entry DictionaryEntry
+	for _, def := range r.Def {
+		if entry.Transcription == "" {
+			entry.Transcription = strings.TrimSpace(def.Ts)
+		}
+		for i, tr := range def.Tr {
+			sense := Sense{Text: strings.TrimSpace(tr.Text), Pos: tr.Pos, Rank: i + 1, Frequency: tr.Fr}
+			if sense.Pos == "" {
+				sense.Pos = def.Pos
+			}
+			for _, syn := range tr.Syn {
+				if syn := strings.TrimSpace(syn.Text); syn != "" {
+					sense.Synonyms = append(sense.Synonyms, syn)
+				}
+			}
+			if sense.Text == "" {
+				if len(sense.Synonyms) == 0 {
+					continue
+				}
+				sense.Text, sense.Synonyms = sense.Synonyms[0], sense.Synonyms[1:]
+			}
+			for _, ex := range tr.Ex {
+				text := ex.Text
+				if len(ex.Tr) > 0 {
+					text += " — " + ex.Tr[0].Text
+				}
+				sense.Examples = append(sense.Examples, text)
+			}
+			entry.Senses = append(entry.Senses, sense)
+		}
+	}
+	return entry
+}
+
+// fetch requests and decodes the raw Yandex response for word.
+func (y *YandexDictionary) fetch(word string) (DicResult, error) {
+	var result DicResult
+
+	y.logs.For("lookup_request", word).Debugf("Yandex lookup: %s", buildLookupURL(y.baseURL, "REDACTED", y.lang, word, y.flags))
+	resp, err := y.client.Get(buildLookupURL(y.baseURL, y.apiKey, y.lang, word, y.flags))
+	if err != nil {
+		return result, fmt.Errorf("fetching translation: %w", redactKey(err))
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return result, fmt.Errorf("reading response: %w", err)
+	}
+	y.logs.For("lookup_response", word).Debugf("Yandex response for %s: %d %s", word, resp.StatusCode, truncateBody(body))
+
+	// An error object must not be mistaken for an empty result.
+	var apiErr yandexAPIError
+	if json.Unmarshal(body, &apiErr) == nil && apiErr.Code != 0 && apiErr.Code != http.StatusOK {
+		return result, &apiErr
+	}
+	if resp.StatusCode != http.StatusOK {
+		return result, fmt.Errorf("Yandex API error: %d - %s", resp.StatusCode, truncateBody(body))
+	}
+
+	if err := json.Unmarshal(body, &result); err != nil {
+		return result, fmt.Errorf("parsing JSON: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,96 @@
+package lingo
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildLookupURL(t *testing.T) {
+	tests := []struct {
+		text  string
+		flags int
+		want  string // the encoded query
+	}{
+		{text: "cat", want: "key=KEY&lang=en-ru&text=cat"},
+		{text: "to run away", want: "key=KEY&lang=en-ru&text=to+run+away"},
+		{text: "rock & roll", want: "key=KEY&lang=en-ru&text=rock+%26+roll"},
+		{text: "c++", want: "key=KEY&lang=en-ru&text=c%2B%2B"},
+		{text: "c#", want: "key=KEY&lang=en-ru&text=c%23"},
+		{text: "a=b?", want: "key=KEY&lang=en-ru&text=a%3Db%3F"},
+		{text: "ёж", want: "key=KEY&lang=en-ru&text=%D1%91%D0%B6"},
+		{text: "cat", flags: YandexMorpho | YandexFamilyFilter, want: "flags=5&key=KEY&lang=en-ru&text=cat"},
+	}
+	// A key with reserved characters must not spill into other parameters.
+	if got := buildLookupURL("https://example.com/lookup", "a&b#c", "en-ru", "cat", 0); got != "https://example.com/lookup?key=a%26b%23c&lang=en-ru&text=cat" {
+		t.Errorf("buildLookupURL with key %q = %q", "a&b#c", got)
+	}
+	for _, tt := range tests {
+		got := buildLookupURL("https://example.com/lookup", "KEY", "en-ru", tt.text, tt.flags)
+		u, err := url.Parse(got)
+		if err != nil {
+			t.Fatalf("buildLookupURL(%q) = %q: %v", tt.text, got, err)
+		}
+		if u.RawQuery != tt.want {
+			t.Errorf("buildLookupURL(%q) query = %q, want %q", tt.text, u.RawQuery, tt.want)
+		}
+		if text := u.Query().Get("text"); text != tt.text {
+			t.Errorf("buildLookupURL(%q) sends text %q", tt.text, text)
+		}
+	}
+}
+
+func TestEntryEmptyTranslationText(t *testing.T) {
+	var result DicResult
+	payload := `{"def": [{"text": "cat", "pos": "noun", "tr": [
+		{"text": "", "pos": "noun", "syn": [{"text": " "}, {"text": "кошка"}, {"text": "кот"}]},
+		{"text": "  ", "pos": "noun"},
+		{"text": "котик", "pos": "noun"}]}]}`
+	if err := json.Unmarshal([]byte(payload), &result); err != nil {
+		t.Fatal(err)
+	}
+	senses := result.entry().Senses
+	// The first falls back to its first non-blank synonym, the second has
+	// none and is dropped; ranks keep the place in the response.
+	want := []Sense{
+		{Text: "кошка", Pos: "noun", Synonyms: []string{"кот"}, Rank: 1},
+		{Text: "котик", Pos: "noun", Rank: 3},
+	}
+	if !reflect.DeepEqual(senses, want) {
+		t.Errorf("senses = %+v, want %+v", senses, want)
+	}
+	if got, ok := firstTranslation(result.entry()); got != "кошка" || !ok {
+		t.Errorf("firstTranslation = %q, %v, want кошка", got, ok)
+	}
+}
+
+func TestLookupErrorHidesKey(t *testing.T) {
+	// Nothing listens on the port of a closed server.
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	y := NewYandexDictionary(server.Client(), server.URL+"/api/lookup", "SECRET-KEY", "en-ru", 0, NewLogger(LevelQuiet, io.Discard, io.Discard))
+
+	_, lookupErr := y.Lookup("cat")
+	_, langsErr := y.Langs()
+	for _, err := range []error{lookupErr, langsErr} {
+		if err == nil {
+			t.Fatal("want an error from a closed server")
+		}
+		if strings.Contains(err.Error(), "SECRET-KEY") {
+			t.Errorf("error reveals the API key: %v", err)
+		}
+		if !strings.Contains(err.Error(), "key=REDACTED") {
+			t.Errorf("error lost the request URL: %v", err)
+		}
+		var urlErr *url.Error
+		if !errors.As(err, &urlErr) {
+			t.Errorf("error %v no longer wraps *url.Error", err)
+		}
+	}
+}
@@ -1,269 +1,792 @@
 package main
 
 import (
-	"bytes"
-	"encoding/csv"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
-	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
 
 	"github.com/joho/godotenv"
-	"github.com/tealeg/xlsx"
+	"github.com/yalexaner/simply-lingo/lingo"
 )
 
-// DicResult represents the structure of the Yandex.Dictionary API JSON response.
-type DicResult struct {
-	Head any          `json:"head"`
-	Def  []Definition `json:"def"`
+// firstNonEmpty returns the first of values that is not empty.
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
 }
 
-type Definition struct {
-	Text string        `json:"text"`
-	Pos  string        `json:"pos"`
-	Tr   []Translation `json:"tr"`
+// parseLanguageVoices parses comma-separated lang=voice pairs such as
+// "de=abc123,fr=def456".
+func parseLanguageVoices(s string) (map[string]string, error) {
+	voices := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		lang, voice, ok := strings.Cut(pair, "=")
+		lang, voice = strings.TrimSpace(lang), strings.TrimSpace(voice)
+		if !ok || lang == "" || voice == "" {
+			return nil, fmt.Errorf("%q is not a lang=voice pair", pair)
+		}
+		voices[lang] = voice
+	}
+	return voices, nil
 }
 
-type Translation struct {
-	Text string    `json:"text"`
-	Pos  string    `json:"pos"`
-	Syn  []Synonym `json:"syn,omitempty"`
-	Mean []Meaning `json:"mean,omitempty"`
-	Ex   []Example `json:"ex,omitempty"`
+// isTimeout reports whether err was caused by a request exceeding the client timeout.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
 }
 
-type Synonym struct {
-	Text string `json:"text"`
+// logFailure logs a failed API step for word, calling out timeouts separately
+// since they are worth retrying.
+func logFailure(logs *lingo.Logger, action, word string, err error, timeout time.Duration) {
+	if isTimeout(err) {
+		logs.For("word_failed", word).Errorf("Timed out %s for %s after %s, will retry on next run", action, word, timeout)
+		return
+	}
+	logs.For("word_failed", word).Errorf("Error %s for %s: %v", action, word, err)
 }
 
-type Meaning struct {
-	Text string `json:"text"`
+// passSaveInterval is how many new translations the first pass gathers
+// between saves of the pass file.
+const passSaveInterval = 25
+
+// loadPassFile reads dictionary entries saved by an earlier translation pass.
+func loadPassFile(path string) (map[string]lingo.DictionaryEntry, error) {
+	translations := map[string]lingo.DictionaryEntry{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return translations, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &translations); err != nil {
+		return nil, err
+	}
+	return translations, nil
 }
 
-type Example struct {
-	Text string        `json:"text"`
-	Tr   []Translation `json:"tr"`
+// savePassFile writes the translations gathered so far, replacing the file atomically.
+func savePassFile(path string, translations map[string]lingo.DictionaryEntry) error {
+	data, err := json.MarshalIndent(translations, "", "  ")
+	if err != nil {
+		return err
+	}
+	return lingo.WriteFileAtomic(path, data)
 }
 
-// ElevenLabsRequest represents the request structure for ElevenLabs TTS API
-type ElevenLabsRequest struct {
-	Text          string        `json:"text"`
-	ModelID       string        `json:"model_id"`
-	VoiceID       string        `json:"voice_id"`
-	VoiceSettings VoiceSettings `json:"voice_settings"`
+// clearLine erases the progress line before a summary line takes its place.
+const clearLine = "\r\033[2K"
+
+func main() {
+	err := run()
+	var usage usageError
+	switch {
+	case errors.As(err, &usage):
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr)
+		flag.Usage()
+		os.Exit(2)
+	case err != nil:
+		log.Print(err)
+		os.Exit(1)
+	}
 }
 
-type VoiceSettings struct {
-	Stability       float64 `json:"stability"`
-	SimilarityBoost float64 `json:"similarity_boost"`
+// usageError is an invalid combination of flags, which main reports with
+// the usage text and exit code 2 rather than as a failed run.
+type usageError struct {
+	err error
 }
 
-func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("Usage: go run main.go <excel_file>")
-		return
+func (e usageError) Error() string { return e.err.Error() }
+func (e usageError) Unwrap() error { return e.err }
+
+// run is the whole program. It returns the errors that end a run early
+// instead of exiting, so deferred closes and flushes still happen.
+func run() error {
+	flag.Usage = printUsage
+	timeout := flag.Duration("timeout", 30*time.Second, "timeout for each HTTP request to the Yandex and ElevenLabs APIs")
+	breakerFailures := flag.Int("breaker-failures", 0, "pause all requests to an API after this many consecutive failures (0 to never pause)")
+	breakerCooldown := flag.Duration("breaker-cooldown", 30*time.Second, "how long requests to a failing API are paused before one is tried again")
+	deadline := flag.Duration("deadline", 0, "stop the whole run after this long, writing the words finished so far (0 for no limit)")
+	asciiFilenames := flag.Bool("ascii-filenames", false, "replace audio filenames containing non-ASCII characters with a hash")
+	withTranscription := flag.Bool("with-transcription", false, "add a column with the dictionary's transcription of each word, empty when it has none")
+	includeIndex := flag.Bool("include-index", false, "prepend an index column holding the 1-based spreadsheet row number of each word, prefixed with its input file and a colon when there are several")
+	logLevelName := flag.String("log-level", "normal", "amount of output: quiet, normal, verbose or debug")
+	logFormat := flag.String("log-format", "text", "format of log messages: text, or json for one object per line")
+	uiLang := flag.String("ui-lang", "en", "language of the progress and summary output: "+strings.Join(lingo.UILanguages(), " or "))
+	logFile := flag.String("log-file", "", "write log messages to this file instead of stderr")
+	twoPass := flag.Bool("two-pass", false, "translate every word first, then generate all audio in a second pass")
+	postprocess := flag.String("postprocess", "", "shell command that receives every output record as a JSON object line on stdin and answers with a line of the fields to replace, or null to leave the record out")
+	postprocessErrors := flag.String("postprocess-errors", "fail", "what a failing -postprocess does to a word: fail stops the run, skip leaves the word out and records it in -failures")
+	wordTransform := flag.String("word-transform", "", "shell command that receives each word on stdin and prints the form to look up and speak")
+	maxCellLength := flag.Int("max-cell-length", 1000, "skip rows whose word is longer than this many characters and truncate longer definitions, guarding the APIs against corrupt cells (0 for no limit; audio is still limited by -max-chars)")
+	skipEmptyDefinition := flag.Bool("skip-empty-definition", false, "skip rows whose definition is empty instead of making cards without an example")
+	dedupe := flag.Bool("dedupe", false, "skip repeated words (compared case-insensitively after trimming)")
+	audioFormat := flag.String("audio-format", "mp3_44100_128", "ElevenLabs output_format, e.g. mp3_44100_128, mp3_22050_32, opus_48000_64 or pcm_16000")
+	explodeExamples := flag.Bool("explode-examples", false, "write one row per dictionary usage example instead of one row per word")
+	maxExamples := flag.Int("max-examples", 5, "maximum number of rows -explode-examples writes per word")
+	ttsProvider := flag.String("tts-provider", "elevenlabs", "speech backend: elevenlabs, or espeak for free offline audio")
+	dictProvider := flag.String("dict-provider", "yandex", "dictionary backend used for translations: yandex")
+	limit := flag.Int("limit", 0, "stop after this many words were processed successfully (0 means no limit)")
+	strict := flag.Bool("strict", false, "leave words without a translation out of the output (and record them in -failures)")
+	failuresFile := flag.String("failures", "", "write words that failed or were left out to this file")
+	retryFailures := flag.String("retry-failures", "", "process only the words of this failures `file` from an earlier run, appending successes to the output and rewriting the file with the words that still fail")
+	estimate := flag.Bool("estimate", false, "count the words and characters a run would send to the APIs, with its cost given -price-per-1000, without making any requests")
+	verify := flag.Bool("verify", false, "check that every [sound:...] reference of the existing output file has a non-empty audio file, list unreferenced audio files, and exit")
+	onlyMissingAudio := flag.Bool("only-missing-audio", false, "regenerate audio missing for rows of the existing output file without fetching translations")
+	flushEvery := flag.Int("flush-every", 10, "flush and sync the output file to disk after this many words (0 flushes only at the end)")
+	posFilter := flag.String("pos", "", "comma-separated parts of speech to prefer when picking a translation, e.g. noun,verb")
+	appendOutput := flag.Bool("append", false, "append to an existing output file instead of overwriting it")
+	header := flag.Bool("header", false, "write a first row naming the output columns")
+	audioDirFlag := flag.String("audio-dir", "audio", "directory where audio files are saved")
+	secretsFile := flag.String("secrets-file", "", "read YANDEX_API_KEY and ELEVENLABS_API_KEY from this KEY=VALUE `file` before the environment; keys missing from both are prompted for on a terminal")
+	yandexURL := flag.String("yandex-url", "", "Yandex.Dictionary lookup endpoint (default $YANDEX_BASE_URL or "+lingo.DefaultYandexBaseURL+")")
+	yandexFlags := flag.Int("yandex-flags", 0, "sum of Yandex lookup flag `bits`: "+lingo.YandexFlagsUsage)
+	elevenLabsURL := flag.String("elevenlabs-url", "", "ElevenLabs text-to-speech endpoint (default $ELEVENLABS_BASE_URL or "+lingo.DefaultElevenLabsBaseURL+")")
+	pricePer1000 := flag.Float64("price-per-1000", 0, "price of 1000 synthesized characters, used to estimate the run's cost")
+	speakTemplateText := flag.String("speak-template", "", "text to synthesize instead of the bare word, with {word}, {definition} and {translation} placeholders")
+	translateWorkers := flag.Int("translate-workers", 1, "number of concurrent translation lookups")
+	audioWorkers := flag.Int("audio-workers", 1, "number of concurrent audio syntheses")
+	expandTranslations := flag.Bool("expand-translations", false, "write one row per distinct translation, with a column for its part of speech")
+	maxTranslations := flag.Int("translations", 3, "maximum number of rows -expand-translations writes per word")
+	topOnly := flag.Bool("top-only", false, "with -expand-translations or -join-translations, keep only the primary translation of each part of speech")
+	minFrequency := flag.Int("min-frequency", 0, "with -expand-translations or -join-translations, leave out translations Yandex rates less common than this, from 1 (rare) to 10 (common)")
+	bundle := flag.String("bundle", "", "after the run, package the output file and the audio directory into this zip `file`")
+	sharedAudio := flag.String("shared-audio", "", "JSON `file`, shared by the runs for any number of decks, recording where the audio of each synthesized text lives, so later runs link to it instead of synthesizing it again")
+	audioCache := flag.String("audio-cache", "", "reuse audio for identical synthesis requests from this `directory`, across runs and decks")
+	translateDefinition := flag.Bool("translate-definition", false, "machine-translate each definition, sentence by sentence, into a definition_translation column")
+	mtURL := flag.String("mt-url", "", "LibreTranslate-compatible endpoint for -translate-definition, with an optional $MT_API_KEY (default $MT_BASE_URL or "+lingo.DefaultLibreTranslateURL+")")
+	mtCache := flag.String("mt-cache", "definitions.json", "`file` keeping definition translations across runs, so each sentence is translated once")
+	langDetect := flag.Bool("lang-detect", false, "detect the source language of each word and look it up in the matching dictionary")
+	defCols := flag.String("def-cols", "", "comma-separated `columns` (letters or 1-based numbers) joined into the definition instead of the second column")
+	defSeparator := flag.String("def-separator", " — ", "separator between the cells joined by -def-cols")
+	langFlag := flag.String("lang", "en-ru", "dictionary language `pair` as source-target, checked against the pairs Yandex supports")
+	langCandidates := flag.String("lang-candidates", "en,de,fr,es,it,ru", "comma-separated source languages -lang-detect chooses from, most likely first")
+	formatName := flag.String("format", "csv", "output format: csv (semicolon-separated output.csv), tsv (tab-separated output.tsv, Anki's default) or jsonl (a JSON object per row in output.jsonl, keyed by column name)")
+	outPath := flag.String("out", "", "output `file`, or - to stream the rows to stdout as they are written, with progress and the summary on stderr (default output.csv, output.tsv or output.jsonl by -format)")
+	columnSpec := flag.String("columns", "", "comma-separated output `fields` in the order they are written, from "+strings.Join(knownColumns, ", ")+"; replaces the default layout and the flags adding columns")
+	quote := flag.String("quote", "minimal", "quoting of output fields: minimal quotes only fields that need it, all quotes every field")
+	reverse := flag.Bool("reverse", false, "put the translation first and the word with its audio after it, for production practice")
+	audioBitrate := flag.String("audio-bitrate", "", "re-encode audio with ffmpeg, downmixed to mono, at this `bitrate` such as 64k")
+	audioSampleRate := flag.Int("audio-sample-rate", 0, "re-encode audio with ffmpeg, downmixed to mono, at this sample rate in Hz such as 22050")
+	audioNaming := flag.String("audio-naming-template", "", "name audio files by this `template` of {word}, {lang}, {index} and {hash}, e.g. {lang}/{word} or {index}_{word}; slashes make subdirectories of the audio directory, except with -media-dir")
+	hashFilenames := flag.Bool("hash-filenames", false, "name audio files by a hash of the synthesized text, language and voice settings, listing the words in manifest.tsv of the audio directory")
+	verifyAudio := flag.Bool("verify-audio", false, "regenerate existing audio files that are empty or lack a valid audio header instead of reusing them")
+	mediaDir := flag.String("media-dir", "", "also copy audio files into this existing `folder`, such as the collection.media folder of an Anki profile")
+	speakExample := flag.Bool("speak-example", false, "also synthesize the example sentence into a second audio file and sound column, with -explode-examples each dictionary example into its own")
+	maxChars := flag.Int("max-chars", 0, "longest text to synthesize, longer text is cut at a word boundary (default 10000 for elevenlabs, no limit for espeak)")
+	skipLong := flag.Bool("skip-long", false, "leave out audio whose text is longer than -max-chars instead of truncating it")
+	ttsHeaders := headerFlag{}
+	flag.Var(ttsHeaders, "tts-header", "extra `\"Key: Value\"` header for ElevenLabs requests (repeatable)")
+	resume := flag.Bool("resume", false, "continue a crashed run from its checkpoint, appending to its output")
+	checkpointFile := flag.String("checkpoint", "checkpoint.json", "file recording the progress of a run after every flush, for -resume")
+	deck := flag.String("deck", "", "Anki deck the imported notes go to, written as a file header")
+	tags := flag.String("tags", "", "space-separated Anki tags added to every note in a tags column")
+	caseMode := flag.String("normalize-case", "preserve", "capitalization of the words: lower, title or preserve (looked up in lowercase unless preserve)")
+	joinTranslations := flag.Bool("join-translations", false, "list up to -translations distinct translations in the translation field, joined by -field-separator")
+	synonyms := flag.Bool("synonyms", false, "add a column with the synonyms of the translation, joined by -field-separator")
+	fieldSeparator := flag.String("field-separator", ", ", "text joining multiple values within one field, e.g. \"<br>\" or \" / \"")
+	cpuProfile := flag.String("cpuprofile", "", "write a CPU profile of the run to this `file`")
+	memProfile := flag.String("memprofile", "", "write a heap profile taken at the end of the run to this `file`")
+	overridesFile := flag.String("overrides", "", "JSON or delimited `file` of word, translation and optional skip-audio entries used instead of dictionary lookups")
+	streamXLSX := flag.Bool("stream-xlsx", false, "read Excel workbooks row by row instead of loading them whole, for workbooks too large for memory, and start on the first words while the rest is read (except with -estimate, -resume, -two-pass and -retry-failures); numbers are read without their display format")
+	inputCharset := flag.String("input-charset", "auto", "encoding of text input (stdin, .csv, .tsv, .txt): auto, utf-8 or windows-1251")
+	languageVoices := flag.String("language-voices", "", "comma-separated `lang=voice` pairs picking the ElevenLabs voice by the language of the spoken word, overriding -voice (default $ELEVENLABS_LANGUAGE_VOICES)")
+	preview := flag.String("preview", "", "synthesize only this `phrase` with the current voice and audio settings into preview.<ext>, to audition a voice before a run")
+	voiceID := flag.String("voice", "21m00Tcm4TlvDq8ikWAM", "ElevenLabs voice `ID`, checked against the account's voices before the run")
+	passFile := flag.String("pass-file", "translations.json", "file where -two-pass keeps translations so the first pass can resume")
+	flag.Parse()
+	if err := validateFlags(); err != nil {
+		return usageError{err}
 	}
-	excelFile := os.Args[1]
 
-	xlFile, err := xlsx.OpenFile(excelFile)
+	level, err := lingo.ParseLogLevel(*logLevelName)
 	if err != nil {
-		log.Fatalf("Failed to open Excel file: %v", err)
-		return
+		return err
+	}
+	if _, err := lingo.AudioExtension(*audioFormat); err != nil {
+		return err
+	}
+	format, ok := outputFormats[*formatName]
+	if !ok {
+		return fmt.Errorf("Unknown output format %q (want csv, tsv or jsonl)", *formatName)
+	}
+	if *outPath != "" {
+		format.path = *outPath
+	}
+	// With -out - stdout carries the rows, so progress and the summary go to
+	// stderr, where the log already is.
+	streaming := format.path == "-"
+	var console io.Writer = os.Stdout
+	if streaming {
+		console = os.Stderr
+	}
+	var speakTemplate *template.Template
+	if *speakTemplateText != "" {
+		speakTemplate, err = lingo.ParseSpeakTemplate(*speakTemplateText)
+		if err != nil {
+			return fmt.Errorf("Invalid -speak-template: %w", err)
+		}
+	}
+	var logOut io.Writer = os.Stderr
+	if *logFile != "" {
+		f, err := os.OpenFile(*logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("Failed to open log file: %w", err)
+		}
+		defer f.Close()
+		logOut = f
+	}
+	logs := lingo.NewLogger(level, logOut, console)
+	if *logFormat == "json" {
+		logs = lingo.NewJSONLogger(level, logOut)
+		// Errors ending the run go through the standard log package.
+		log.SetFlags(0)
+		log.SetOutput(logs.Writer())
 	}
 
-	if len(xlFile.Sheets) == 0 {
-		log.Fatalf("No sheets found in the Excel file.")
-		return
+	// Checked by validateFlags already.
+	msgs, _ := lingo.NewMessages(*uiLang)
+	logs.SetMessages(msgs)
+
+	stopProfiling, err := startProfiling(*cpuProfile, *memProfile)
+	if err != nil {
+		return fmt.Errorf("Failed to start profiling: %w", err)
+	}
+	defer func() {
+		if err := stopProfiling(); err != nil {
+			logs.Errorf("Error %v", err)
+		}
+	}()
+
+	if err := godotenv.Load(); err != nil {
+		logs.Warnf(".env file not found")
 	}
-	sheet := xlFile.Sheets[0]
 
-	totalWords := 0
-	for _, row := range sheet.Rows {
-		if len(row.Cells) >= 2 {
-			totalWords++
+	if *verify {
+		report, err := verifyOutput(format, *audioDirFlag)
+		if err != nil {
+			return fmt.Errorf("Failed to verify %s: %w", format.path, err)
 		}
+		report.print(console, msgs, format, *audioDirFlag, true)
+		if len(report.dangling) > 0 {
+			return fmt.Errorf("%d sound references in %s have no audio file", len(report.dangling), format.path)
+		}
+		return nil
 	}
 
-	outputFile, err := os.Create("output.csv")
-	if err != nil {
-		log.Fatalf("Failed to create output.csv: %v", err)
-		return
+	// Keys come from the -secrets-file first, then the environment (and
+	// .env), and are prompted for when still missing on a terminal that
+	// isn't also the word list.
+	secrets := map[string]string{}
+	if *secretsFile != "" {
+		secrets, err = loadSecrets(*secretsFile, logs)
+		if err != nil {
+			return fmt.Errorf("Failed to read %s: %w", *secretsFile, err)
+		}
 	}
-	defer outputFile.Close()
+	canPrompt := isTerminal(os.Stdin) && !slices.Contains(flag.Args(), "-")
 
-	csvWriter := csv.NewWriter(outputFile)
-	csvWriter.Comma = ';'
-	defer csvWriter.Flush()
+	yandexAPIKey := firstNonEmpty(secrets["YANDEX_API_KEY"], os.Getenv("YANDEX_API_KEY"))
+	if *dictProvider == "yandex" && !*onlyMissingAudio && !*estimate && *preview == "" {
+		if yandexAPIKey, err = apiKey("YANDEX_API_KEY", secrets, canPrompt); err != nil {
+			return err
+		}
+	}
 
-	if err := godotenv.Load(); err != nil {
-		log.Printf("Warning: .env file not found")
+	elevenLabsAPIKey := firstNonEmpty(secrets["ELEVENLABS_API_KEY"], os.Getenv("ELEVENLABS_API_KEY"))
+	if *ttsProvider == "elevenlabs" && !*estimate {
+		if elevenLabsAPIKey, err = apiKey("ELEVENLABS_API_KEY", secrets, canPrompt); err != nil {
+			return err
+		}
 	}
 
-	yandexAPIKey := os.Getenv("YANDEX_API_KEY")
-	if yandexAPIKey == "" {
-		log.Fatal("YANDEX_API_KEY environment variable is required")
-		return
+	audioDir := *audioDirFlag
+	if *preview == "" {
+		if err := os.MkdirAll(audioDir, 0755); err != nil {
+			return fmt.Errorf("Failed to create audio directory: %w", err)
+		}
 	}
 
-	elevenLabsAPIKey := os.Getenv("ELEVENLABS_API_KEY")
-	if elevenLabsAPIKey == "" {
-		log.Fatal("ELEVENLABS_API_KEY environment variable is required")
-		return
+	if *mediaDir != "" {
+		// A missing folder most likely means a mistyped profile path, which
+		// creating it would hide from Anki.
+		if info, err := os.Stat(*mediaDir); err != nil || !info.IsDir() {
+			return fmt.Errorf("-media-dir %s is not an existing folder; point it at the collection.media folder of your Anki profile", *mediaDir)
+		}
 	}
 
-	audioDir := "audio"
-	if err := os.MkdirAll(audioDir, 0755); err != nil {
-		log.Fatalf("Failed to create audio directory: %v", err)
-		return
+	lang := *langFlag
+	yandexBaseURL := firstNonEmpty(*yandexURL, os.Getenv("YANDEX_BASE_URL"))
+	elevenLabsBaseURL := firstNonEmpty(*elevenLabsURL, os.Getenv("ELEVENLABS_BASE_URL"))
+
+	// -deadline bounds the whole run: once it passes, no new words are
+	// started and requests in flight are aborted.
+	ctx := context.Background()
+	if *deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *deadline)
+		defer cancel()
+	}
+
+	// A single client with a timeout is shared by both APIs so a stalled
+	// connection can't hang the whole run.
+	client := &http.Client{Timeout: *timeout, Transport: contextTransport{ctx, decodingTransport{http.DefaultTransport}}}
+
+	// With -lang-detect every candidate source language gets its own pair.
+	_, target, _ := strings.Cut(lang, "-")
+	pairs := []string{lang}
+	var candidates []string
+	if *langDetect {
+		pairs = nil
+		for _, c := range strings.Split(*langCandidates, ",") {
+			if c = strings.TrimSpace(c); c != "" {
+				candidates = append(candidates, c)
+				if c != target {
+					pairs = append(pairs, c+"-"+target)
+				}
+			}
+		}
 	}
 
-	lang := "en-ru"
-	yandexBaseURL := "https://dictionary.yandex.net/api/v1/dicservice.json/lookup"
-	elevenLabsBaseURL := "https://api.elevenlabs.io/v1/text-to-speech"
+	var newDict func(lang string) lingo.DictionaryProvider
+	switch *dictProvider {
+	case "yandex":
+		newDict = func(lang string) lingo.DictionaryProvider {
+			return lingo.NewYandexDictionary(client, yandexBaseURL, yandexAPIKey, lang, *yandexFlags, logs)
+		}
+		if !*onlyMissingAudio && !*estimate && *preview == "" {
+			if err := lingo.NewYandexDictionary(client, yandexBaseURL, yandexAPIKey, lang, *yandexFlags, logs).CheckLangs(pairs...); err != nil {
+				return fmt.Errorf("Failed to check -lang: %w", err)
+			}
+		}
+	default:
+		return fmt.Errorf("Unknown dictionary provider %q (want yandex)", *dictProvider)
+	}
+	if *breakerFailures > 0 {
+		// The breaker goes around each pair's own dictionary, so only the
+		// API's failures count, not words -lang-detect can't place.
+		breaker := lingo.NewBreaker(ctx, *dictProvider, *breakerFailures, *breakerCooldown, logs)
+		lookup := newDict
+		newDict = func(lang string) lingo.DictionaryProvider {
+			return lingo.BreakerDictionary{DictionaryProvider: lookup(lang), Breaker: breaker}
+		}
+	}
+	dict := newDict(lang)
+	if *langDetect {
+		dict, err = lingo.NewLangDetectingDictionary(candidates, target, newDict, logs)
+		if err != nil {
+			return fmt.Errorf("Invalid -lang-candidates: %w", err)
+		}
+	}
+	var definitions *lingo.CachingTranslator
+	if *translateDefinition {
+		mt := lingo.NewLibreTranslate(client, firstNonEmpty(*mtURL, os.Getenv("MT_BASE_URL")), firstNonEmpty(secrets["MT_API_KEY"], os.Getenv("MT_API_KEY")), logs)
+		definitions, err = lingo.NewCachingTranslator(mt, *mtCache)
+		if err != nil {
+			return fmt.Errorf("Failed to read %s: %w", *mtCache, err)
+		}
+		defer func() {
+			if err := definitions.Save(); err != nil {
+				logs.Errorf("Error saving %s: %v", *mtCache, err)
+			}
+		}()
+	}
+	var tts lingo.TTSProvider
+	switch *ttsProvider {
+	case "elevenlabs":
+		langVoices, err := parseLanguageVoices(firstNonEmpty(*languageVoices, os.Getenv("ELEVENLABS_LANGUAGE_VOICES")))
+		if err != nil {
+			return fmt.Errorf("Invalid -language-voices: %w", err)
+		}
+		elevenLabs, err := lingo.NewElevenLabsTTS(ctx, client, elevenLabsBaseURL, elevenLabsAPIKey, *voiceID, langVoices, *audioFormat, http.Header(ttsHeaders), logs)
+		if err != nil {
+			return err
+		}
+		if !*estimate {
+			if err := elevenLabs.CheckVoice(); err != nil {
+				return fmt.Errorf("Failed to check -voice: %w", err)
+			}
+		}
+		tts = elevenLabs
+	case "espeak":
+		tts, err = lingo.NewEspeakTTS()
+		if err != nil {
+			return fmt.Errorf("Failed to set up espeak: %w", err)
+		}
+	default:
+		return fmt.Errorf("Unknown TTS provider %q (want elevenlabs or espeak)", *ttsProvider)
+	}
+	if *breakerFailures > 0 {
+		tts = lingo.BreakerTTS{TTSProvider: tts, Breaker: lingo.NewBreaker(ctx, *ttsProvider, *breakerFailures, *breakerCooldown, logs)}
+	}
+	usage := &lingo.Usage{}
+	dict = lingo.CountingDictionary{DictionaryProvider: dict, Usage: usage}
+	tts = lingo.CountingTTS{TTSProvider: tts, Usage: usage}
+	if *audioBitrate != "" || *audioSampleRate > 0 {
+		transcoder, err := lingo.NewTranscodingTTS(tts, *audioBitrate, *audioSampleRate)
+		if err != nil {
+			logs.Warnf("%v, keeping audio as generated", err)
+		} else {
+			tts = transcoder
+		}
+	}
+	sourceLang, _, _ := strings.Cut(lang, "-")
 
-	voiceID := "21m00Tcm4TlvDq8ikWAM"
+	if *preview != "" {
+		// The preview goes through the same providers as a run, but not the
+		// cache, so changed settings are always heard.
+		data, err := tts.Synthesize(*preview, sourceLang)
+		if err != nil {
+			return fmt.Errorf("Failed to synthesize the preview: %w", err)
+		}
+		path := "preview." + tts.Extension()
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return fmt.Errorf("Failed to write %s: %w", path, err)
+		}
+		fmt.Fprintln(console, msgs.Sprintf("Preview of %q written to %s", *preview, path))
+		usage.Report(console, *pricePer1000, msgs)
+		return nil
+	}
 
-	processedWords := 0
+	if *audioCache != "" {
+		// Wrapping the counter means cache hits are not counted as API usage.
+		tts, err = lingo.NewCachingTTS(tts, *audioCache, logs)
+		if err != nil {
+			return fmt.Errorf("Failed to open audio cache %s: %w", *audioCache, err)
+		}
+	}
 
-	for _, row := range sheet.Rows {
-		// Skip rows that do not have at least two cells.
-		if len(row.Cells) < 2 {
-			continue
+	var shared *lingo.SharedAudio
+	if *sharedAudio != "" {
+		shared, err = lingo.OpenSharedAudio(*sharedAudio, logs)
+		if err != nil {
+			return fmt.Errorf("Failed to read %s: %w", *sharedAudio, err)
 		}
+	}
 
-		// Read the English word and definition.
-		word := row.Cells[0].String()
-		definition := row.Cells[1].String()
+	var partsOfSpeech []string
+	for _, pos := range strings.Split(*posFilter, ",") {
+		if pos = strings.TrimSpace(pos); pos != "" {
+			partsOfSpeech = append(partsOfSpeech, pos)
+		}
+	}
 
-		// Print progress information
-		fmt.Printf("\r\033[2KProcessing word: %s\n", word)
-		fmt.Printf("Current progress: %d/%d", processedWords, totalWords)
+	// Checked by validateFlags already.
+	audioNameTemplate := ""
+	if *audioNaming != "" {
+		audioNameTemplate, _ = lingo.ParseAudioNameTemplate(*audioNaming, tts.Extension())
+	}
+	audio := lingo.AudioSettings{Dir: audioDir, Lang: sourceLang, ASCIIFilenames: *asciiFilenames, Speak: speakTemplate, MaxChars: *maxChars, SkipLong: *skipLong, SpeakExample: *speakExample, MediaDir: *mediaDir, Verify: *verifyAudio, HashFilenames: *hashFilenames, NameTemplate: audioNameTemplate, Shared: shared}
+	if *maxChars == 0 && *ttsProvider == "elevenlabs" {
+		audio.MaxChars = lingo.ElevenLabsMaxChars
+	}
+	if *explodeExamples {
+		// The rows show the dictionary examples, so those are spoken.
+		audio.Examples = *maxExamples
+	}
+	cfg := lingo.Config{
+		Dictionary:       dict,
+		TTS:              tts,
+		Logs:             logs,
+		PartsOfSpeech:    partsOfSpeech,
+		Audio:            audio,
+		Strict:           *strict,
+		TranslateWorkers: *translateWorkers,
+		AudioWorkers:     *audioWorkers,
+		Limit:            *limit,
+	}
+	if definitions != nil {
+		// A nil *CachingTranslator must not become a non-nil interface.
+		cfg.DefinitionTranslator, cfg.TargetLang = definitions, target
+	}
+	proc := lingo.NewProcessor(cfg)
+	columns := outputColumns(columnOptions{index: *includeIndex, pos: *expandTranslations, reverse: *reverse, tags: *tags != "", synonyms: *synonyms, exampleSound: *speakExample, transcription: *withTranscription, definitionTranslation: *translateDefinition})
+	if *columnSpec != "" {
+		// Checked by validateFlags already.
+		columns, _ = parseColumnSpec(*columnSpec)
+	}
 
-		// Get an example sentence (using the definition from Excel)
-		exampleSentence := definition
+	if *onlyMissingAudio {
+		created, failed, err := regenerateMissingAudio(ctx, format, columns, proc, audio, logs)
+		if err != nil {
+			return fmt.Errorf("Failed to read %s: %w", format.path, err)
+		}
+		if ctx.Err() != nil {
+			fmt.Fprintln(console, clearLine+msgs.Sprintf("Stopped early because the -deadline of %s passed", *deadline))
+		}
+		fmt.Fprintln(console, clearLine+msgs.Sprintf("Created %d missing audio files, %d failed", created, failed))
+		usage.Report(console, *pricePer1000, msgs)
+		return nil
+	}
 
-		// Build the Yandex API request URL.
-		url := fmt.Sprintf("%s?key=%s&lang=%s&text=%s", yandexBaseURL, yandexAPIKey, lang, word)
-		resp, err := http.Get(url)
+	inputs, err := expandInputs(flag.Args())
+	if err != nil {
+		return err
+	}
+	if *retryFailures != "" {
+		inputs = []string{*retryFailures}
+		*failuresFile = *retryFailures
+	}
+	opts := entryOptions{
+		retry:               *retryFailures != "",
+		charset:             *inputCharset,
+		stream:              *streamXLSX,
+		defSeparator:        *defSeparator,
+		caseMode:            *caseMode,
+		maxCellLength:       *maxCellLength,
+		skipEmptyDefinition: *skipEmptyDefinition,
+		dedupe:              *dedupe,
+		// Anki separates tags with spaces, so any run of spaces or commas in
+		// -tags separates two tags.
+		tags:      strings.Join(strings.FieldsFunc(*tags, func(r rune) bool { return r == ',' || unicode.IsSpace(r) }), " "),
+		overrides: overrides{},
+	}
+	if *defCols != "" {
+		opts.definitionColumns, err = parseColumns(*defCols)
 		if err != nil {
-			log.Printf("\r\033[2KError fetching translation for %s: %v", word, err)
-			fmt.Printf("Current progress: %d/%d", processedWords, totalWords)
-			continue
+			return fmt.Errorf("Invalid -def-cols: %w", err)
 		}
-		body, err := io.ReadAll(resp.Body)
-		resp.Body.Close()
+	}
+	if *overridesFile != "" {
+		opts.overrides, err = loadOverrides(*overridesFile, *inputCharset)
 		if err != nil {
-			log.Printf("\r\033[2KError reading response for %s: %v", word, err)
-			fmt.Printf("Current progress: %d/%d", processedWords, totalWords)
-			continue
+			return fmt.Errorf("Failed to read %s: %w", *overridesFile, err)
+		}
+	}
+	// prepare gives an entry its looked-up term and audio file name before
+	// it is processed.
+	var transformer *wordTransformer
+	if *wordTransform != "" {
+		transformer = newWordTransformer(*wordTransform)
+	}
+	namer := lingo.NewAudioNamer(*asciiFilenames, audioNameTemplate, tts.Extension(), logs)
+	prepare := func(e *lingo.Entry) {
+		if transformer != nil {
+			transformTerm(e, transformer, logs)
+		}
+		if !*hashFilenames {
+			namer.Assign(e)
 		}
+	}
 
-		var result DicResult
-		if err := json.Unmarshal(body, &result); err != nil {
-			log.Printf("\r\033[2KError parsing JSON for %s: %v", word, err)
-			fmt.Printf("Current progress: %d/%d", processedWords, totalWords)
-			continue
+	// With -stream-xlsx a plain run processes the words while they are read;
+	// -estimate, -resume, -two-pass and -retry-failures need all of them
+	// first.
+	var stream *entryStream
+	var entries []lingo.Entry
+	var previousFailure map[int]string
+	var inputWords map[string]int
+	if *streamXLSX && !*estimate && !*resume && !*twoPass && *retryFailures == "" {
+		stream = newEntryStream(inputs, opts, logs, prepare)
+	} else {
+		set, err := readEntries(inputs, opts, logs)
+		if err != nil {
+			return err
 		}
+		entries, previousFailure, inputWords = set.entries, set.previousFailure, set.inputWords
+		for i := range entries {
+			prepare(&entries[i])
+		}
+	}
 
-		// Retrieve the first translation from the result, if available.
-		russian := ""
-		if len(result.Def) > 0 && len(result.Def[0].Tr) > 0 {
-			russian = result.Def[0].Tr[0].Text
+	if *estimate {
+		printEstimate(console, msgs, proc, entries, *limit, *speakTemplateText != "", *pricePer1000, logs)
+		return nil
+	}
+
+	// A checkpoint is written after every flush and removed when the run
+	// completes, so one left behind means the run that wrote it crashed.
+	progress := checkpoint{Inputs: inputs, Lang: lang, Format: *formatName, Columns: columns}
+	// Retried words are added to the output of the run they failed in.
+	appendMode := *appendOutput || *retryFailures != ""
+	// keepFailure picks the failures of a crashed run to carry over: those
+	// of the words before its checkpoint.
+	var keepFailure func(word, definition string) bool
+	if *resume {
+		rest, ok, err := resumeEntries(*checkpointFile, format, audioDir, progress, entries, logs)
+		if err != nil {
+			return err
 		}
+		if ok {
+			entries, appendMode = rest, true
+			keepFailure = notRerun(entries)
+		}
+	}
 
-		// Generate audio with ElevenLabs API
-		audioFilename := fmt.Sprintf("%s.mp3", word)
-		audioPath := filepath.Join(audioDir, audioFilename)
+	outputFile, outputIsNew, err := openOutput(format, appendMode, columns)
+	if err != nil {
+		return fmt.Errorf("Failed to open %s: %w", format.path, err)
+	}
+	defer outputFile.Close()
 
-		// Check if audio file already exists, generate only if needed
-		if _, err := os.Stat(audioPath); os.IsNotExist(err) {
-			// Prepare request for ElevenLabs
-			elevenLabsReq := ElevenLabsRequest{
-				Text:    word,
-				ModelID: "eleven_multilingual_v2",
-				VoiceID: voiceID,
-				VoiceSettings: VoiceSettings{
-					Stability:       0.5,
-					SimilarityBoost: 0.5,
-				},
-			}
+	csvWriter := format.newWriter(outputFile, columns, *quote == "all")
+	defer csvWriter.Flush()
 
-			reqBody, err := json.Marshal(elevenLabsReq)
-			if err != nil {
-				log.Printf("\r\033[2KError creating request for ElevenLabs for %s: %v", word, err)
-				fmt.Printf("Current progress: %d/%d", processedWords, totalWords)
-				continue
-			}
+	// The header names the columns actually written; an appended file keeps
+	// the header it already has. JSON Lines has no room for Anki's headers.
+	if (*deck != "" || *tags != "") && outputIsNew && !format.jsonl {
+		if err := format.writeAnkiHeaders(outputFile, *deck, columns); err != nil {
+			return fmt.Errorf("Failed to write Anki headers: %w", err)
+		}
+	}
+	if *header && outputIsNew {
+		if err := csvWriter.Write(columns); err != nil {
+			return fmt.Errorf("Failed to write header: %w", err)
+		}
+	}
 
-			// Create the HTTP request
-			req, err := http.NewRequest("POST", fmt.Sprintf("%s/%s", elevenLabsBaseURL, voiceID), bytes.NewBuffer(reqBody))
-			if err != nil {
-				log.Printf("\r\033[2KError creating HTTP request for %s: %v", word, err)
-				fmt.Printf("Current progress: %d/%d", processedWords, totalWords)
-				continue
+	var post *postProcessor
+	if *postprocess != "" {
+		post = newPostProcessor(ctx, *postprocess, *timeout)
+		defer func() {
+			if err := post.close(); err != nil {
+				logs.Errorf("Error running %q: %v", *postprocess, err)
 			}
+		}()
+	}
+	out := &deckWriter{
+		rows:    csvWriter,
+		file:    outputFile,
+		format:  format,
+		columns: columns,
+		cards: cardOptions{
+			expand:          *expandTranslations,
+			join:            *joinTranslations,
+			maxTranslations: *maxTranslations,
+			rankFilter:      lingo.RankFilter{TopOnly: *topOnly, MinFrequency: *minFrequency},
+			fieldSeparator:  *fieldSeparator,
+			explodeExamples: *explodeExamples,
+			maxExamples:     *maxExamples,
+			sourceIndex:     len(inputs) > 1,
+		},
+		streaming:      streaming,
+		flushEvery:     *flushEvery,
+		checkpointFile: *checkpointFile,
+		progress:       progress,
+		post:           post,
+		postprocess:    *postprocess,
+		logs:           logs,
+		writtenWords:   map[string]int{},
+	}
 
-			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("xi-api-key", elevenLabsAPIKey)
+	var failures *failureLog
+	if *failuresFile != "" {
+		failures, err = createFailureLog(*failuresFile, *resume, keepFailure)
+		if err != nil {
+			return fmt.Errorf("Failed to create %s: %w", *failuresFile, err)
+		}
+		defer failures.Close()
+	}
 
-			// Execute the request
-			client := &http.Client{}
-			resp, err := client.Do(req)
-			if err != nil {
-				log.Printf("\r\033[2KError generating audio for %s: %v", word, err)
-				fmt.Printf("Current progress: %d/%d", processedWords, totalWords)
-				continue
-			}
-			defer resp.Body.Close()
+	dr := &deckRun{
+		proc:              proc,
+		out:               out,
+		failures:          failures,
+		logs:              logs,
+		timeout:           *timeout,
+		strict:            *strict,
+		postprocessErrors: *postprocessErrors,
+		limit:             *limit,
+		handled:           map[int]bool{},
+	}
+	if *twoPass {
+		if err := dr.processTwoPass(ctx, entries, *passFile); err != nil {
+			return err
+		}
+	} else if stream != nil {
+		dr.process(ctx, stream.all, -1)
+		set, err := stream.finish()
+		if err != nil {
+			return err
+		}
+		entries, previousFailure, inputWords = set.entries, set.previousFailure, set.inputWords
+	} else {
+		dr.process(ctx, lingo.All(entries), len(entries))
+	}
 
-			if resp.StatusCode != http.StatusOK {
-				responseBody, _ := io.ReadAll(resp.Body)
-				log.Printf("\r\033[2KElevenLabs API error for %s: %d - %s", word, resp.StatusCode, string(responseBody))
-				fmt.Printf("Current progress: %d/%d", processedWords, totalWords)
-				continue
-			}
+	// Words a retry didn't get to, e.g. because of -limit or -deadline, stay
+	// in the failures file for the next one.
+	if *retryFailures != "" {
+		dr.recordUnhandled(entries, previousFailure)
+	}
 
-			// Save the audio file
-			audioFile, err := os.Create(audioPath)
-			if err != nil {
-				log.Printf("\r\033[2KError creating audio file for %s: %v", word, err)
-				fmt.Printf("Current progress: %d/%d", processedWords, totalWords)
-				continue
-			}
+	if dr.postErr != nil {
+		// The checkpoint stays, so -resume continues after the last row
+		// written once the command is fixed.
+		return dr.postErr
+	}
 
-			_, err = io.Copy(audioFile, resp.Body)
-			audioFile.Close()
-			if err != nil {
-				log.Printf("\r\033[2KError saving audio file for %s: %v", word, err)
-				fmt.Printf("Current progress: %d/%d", processedWords, totalWords)
-				continue
-			}
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		logs.Errorf("Error flushing %s, keeping %s: %v", format.path, *checkpointFile, err)
+	} else if err := os.Remove(*checkpointFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		logs.Errorf("Error removing %s: %v", *checkpointFile, err)
+	}
 
-			log.Printf("\r\033[2KCreated audio file for: %s", word)
-			fmt.Printf("Current progress: %d/%d", processedWords, totalWords)
-		} else {
-			log.Printf("\r\033[2KAudio file for %s already exists, skipping generation", word)
-			fmt.Printf("Current progress: %d/%d", processedWords, totalWords)
+	if *hashFilenames {
+		if err := updateManifest(audioDir, entries); err != nil {
+			logs.Errorf("Error writing the audio manifest: %v", err)
 		}
+	}
 
-		// Format for Anki: [sound:filename.mp3]
-		soundField := fmt.Sprintf("[sound:%s]", audioFilename)
-
-		// Write the output row to the CSV, ensuring proper handling of fields with semicolons
-		// The csv.Writer will automatically handle quoting and escaping when needed
-		err = csvWriter.Write([]string{word, exampleSentence, soundField, russian})
-		if err != nil {
-			log.Printf("\r\033[2KError writing CSV row for %s: %v", word, err)
-			fmt.Printf("Current progress: %d/%d", processedWords, totalWords)
+	summary := runSummary{
+		run:           dr,
+		entries:       entries,
+		inputs:        inputs,
+		inputWords:    inputWords,
+		deadline:      *deadline,
+		stopped:       ctx.Err() != nil,
+		outputName:    format.path,
+		audioDir:      audioDir,
+		format:        format,
+		overridesFile: *overridesFile,
+	}
+	if streaming {
+		summary.outputName = "stdout"
+	} else {
+		// Cross-check the finished output, so a reference without its audio
+		// is found before Anki imports it.
+		if report, err := verifyOutput(format, audioDir); err != nil {
+			logs.Errorf("Error verifying %s: %v", format.path, err)
+		} else {
+			summary.report = &report
 		}
+	}
 
-		// Update progress counter and display
-		processedWords++
+	if *bundle != "" {
+		csvWriter.Flush()
+		if err := csvWriter.Error(); err != nil {
+			logs.Errorf("Error flushing %s: %v", format.path, err)
+		} else if err := writeBundle(*bundle, format.path, audioDir); err != nil {
+			logs.Errorf("Error writing %s: %v", *bundle, err)
+		} else {
+			summary.bundle = *bundle
+		}
 	}
 
-	fmt.Printf("\r\033[2KProcessing %d words complete. Output written to output.csv\n", totalWords)
-	fmt.Printf("Audio files saved to the '%s' directory\n", audioDir)
+	printSummary(console, msgs, summary)
+	usage.Report(console, *pricePer1000, msgs)
+	return nil
 }
@@ -0,0 +1,491 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/yalexaner/simply-lingo/lingo"
+)
+
+// testVoice is the only voice the fake ElevenLabs account has, and run's
+// default -voice.
+const testVoice = "21m00Tcm4TlvDq8ikWAM"
+
+// fakeAPIs serves the Yandex.Dictionary and ElevenLabs endpoints run talks
+// to. Words found in translations are looked up as nouns, with their
+// examples, others have no entry; speech is fakeAudio of the synthesized text.
+type fakeAPIs struct {
+	translations map[string]string   // word -> translation
+	examples     map[string][]string // word -> usage examples
+	yandex       *httptest.Server
+	elevenLabs   *httptest.Server
+
+	mu      sync.Mutex
+	lookups []string // words looked up, in order
+	spoken  []string // texts synthesized, in order
+}
+
+// fakeAudio is what the fake ElevenLabs returns for text: an MP3 header
+// followed by the text, so tests can tell which audio ended up where.
+func fakeAudio(text string) []byte {
+	return []byte("ID3" + text)
+}
+
+func newFakeAPIs(t testing.TB, translations map[string]string) *fakeAPIs {
+	f := &fakeAPIs{translations: translations, examples: map[string][]string{}}
+
+	yandex := http.NewServeMux()
+	yandex.HandleFunc("GET /api/getLangs", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]string{"en-ru", "de-ru"})
+	})
+	yandex.HandleFunc("GET /api/lookup", func(w http.ResponseWriter, r *http.Request) {
+		word := r.URL.Query().Get("text")
+		f.mu.Lock()
+		f.lookups = append(f.lookups, word)
+		f.mu.Unlock()
+		result := lingo.DicResult{Def: []lingo.Definition{}}
+		if tr, ok := f.translations[word]; ok {
+			translation := lingo.Translation{Text: tr, Pos: "noun"}
+			for _, ex := range f.examples[word] {
+				translation.Ex = append(translation.Ex, lingo.Example{Text: ex})
+			}
+			result.Def = append(result.Def, lingo.Definition{Text: word, Pos: "noun", Tr: []lingo.Translation{translation}})
+		}
+		json.NewEncoder(w).Encode(result)
+	})
+	f.yandex = httptest.NewServer(yandex)
+	t.Cleanup(f.yandex.Close)
+
+	elevenLabs := http.NewServeMux()
+	elevenLabs.HandleFunc("GET /v1/voices", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"voices": [{"voice_id": "` + testVoice + `", "name": "Test"}]}`))
+	})
+	elevenLabs.HandleFunc("POST /v1/text-to-speech/{voice}", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Text string `json:"text"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		f.spoken = append(f.spoken, req.Text)
+		f.mu.Unlock()
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Write(fakeAudio(req.Text))
+	})
+	f.elevenLabs = httptest.NewServer(elevenLabs)
+	t.Cleanup(f.elevenLabs.Close)
+	return f
+}
+
+// args returns the flags pointing run at the fake servers.
+func (f *fakeAPIs) args() []string {
+	return []string{
+		"-yandex-url", f.yandex.URL + "/api/lookup",
+		"-elevenlabs-url", f.elevenLabs.URL + "/v1/text-to-speech",
+	}
+}
+
+// runMain runs the program with args in a fresh directory, which it returns,
+// with the API keys set. Input files are given relative to the repository.
+func runMain(t testing.TB, args ...string) (string, error) {
+	t.Helper()
+	for i, arg := range args {
+		if strings.HasPrefix(arg, "testdata/") {
+			abs, err := filepath.Abs(arg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			args[i] = abs
+		}
+	}
+	dir := t.TempDir()
+	t.Chdir(dir)
+	t.Setenv("YANDEX_API_KEY", "test-yandex-key")
+	t.Setenv("ELEVENLABS_API_KEY", "test-elevenlabs-key")
+
+	savedArgs, savedFlags, savedUsage := os.Args, flag.CommandLine, flag.Usage
+	t.Cleanup(func() { os.Args, flag.CommandLine, flag.Usage = savedArgs, savedFlags, savedUsage })
+	os.Args = append([]string{"simply-lingo"}, args...)
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	return dir, run()
+}
+
+// readLines returns the lines of the file at path.
+func readLines(t testing.TB, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+func TestRun(t *testing.T) {
+	translations := map[string]string{"run": "бежать", "sprint": "спринт", "cat": "кошка"}
+	tests := []struct {
+		name  string
+		args  []string
+		input string // file under testdata, or
+		words string // the lines of a tab-separated input file
+		// want are the lines of output.csv and audio the files of the audio
+		// directory with the text they were synthesized from; lookups, when
+		// set, are the words looked up.
+		want    []string
+		audio   map[string]string
+		lookups []string
+	}{
+		{
+			name:  "merged xlsx",
+			input: "testdata/merged.xlsx",
+			want: []string{
+				"run;to move fast;[sound:run.mp3];бежать",
+				"sprint;to move fast;[sound:sprint.mp3];спринт",
+				"cat;a small animal;[sound:cat.mp3];кошка",
+			},
+			audio: map[string]string{"run.mp3": "run", "sprint.mp3": "sprint", "cat.mp3": "cat"},
+		},
+		{
+			name:  "streamed xlsx",
+			args:  []string{"-stream-xlsx"},
+			input: "testdata/merged.xlsx",
+			want: []string{
+				"run;to move fast;[sound:run.mp3];бежать",
+				"sprint;to move fast;[sound:sprint.mp3];спринт",
+				"cat;a small animal;[sound:cat.mp3];кошка",
+			},
+			audio: map[string]string{"run.mp3": "run", "sprint.mp3": "sprint", "cat.mp3": "cat"},
+		},
+		{
+			name:  "header and reverse",
+			args:  []string{"-header", "-reverse"},
+			input: "testdata/merged.xlsx",
+			want: []string{
+				"translation;word;example;sound",
+				"бежать;run;to move fast;[sound:run.mp3]",
+				"спринт;sprint;to move fast;[sound:sprint.mp3]",
+				"кошка;cat;a small animal;[sound:cat.mp3]",
+			},
+			audio: map[string]string{"run.mp3": "run", "sprint.mp3": "sprint", "cat.mp3": "cat"},
+		},
+		{
+			name:  "phrases and empty words",
+			words: "  sprint  \tfast run\n\tonly a definition\n   \tspaces only\nrun away\tto escape\n",
+			want: []string{
+				"sprint;fast run;[sound:sprint.mp3];спринт",
+				"run away;to escape;[sound:run_away.mp3];",
+			},
+			audio:   map[string]string{"sprint.mp3": "sprint", "run_away.mp3": "run away"},
+			lookups: []string{"sprint", "run away"},
+		},
+		{
+			// A word -lang-detect can't place is not a failure of the API,
+			// so the breaker must not hold the next word back.
+			name:  "undetected language keeps the breaker closed",
+			args:  []string{"-lang-detect", "-lang-candidates", "en", "-breaker-failures", "1", "-breaker-cooldown", "1h", "-deadline", "10s"},
+			words: "кошка\tcat\ncat\ta small animal\n",
+			want:  []string{"cat;a small animal;[sound:cat.mp3];кошка"},
+			audio: map[string]string{"cat.mp3": "cat"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apis := newFakeAPIs(t, translations)
+			input := tt.input
+			if tt.words != "" {
+				input = filepath.Join(t.TempDir(), "words.tsv")
+				if err := os.WriteFile(input, []byte(tt.words), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			args := append(apis.args(), tt.args...)
+			dir, err := runMain(t, append(args, input)...)
+			if err != nil {
+				t.Fatalf("run: %v", err)
+			}
+			if tt.lookups != nil && !slices.Equal(apis.lookups, tt.lookups) {
+				t.Errorf("looked up %q, want %q", apis.lookups, tt.lookups)
+			}
+
+			if got := readLines(t, filepath.Join(dir, "output.csv")); !slices.Equal(got, tt.want) {
+				t.Errorf("output.csv:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+			files, err := os.ReadDir(filepath.Join(dir, "audio"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != len(tt.audio) {
+				t.Errorf("audio directory has %d files, want %d", len(files), len(tt.audio))
+			}
+			for name, text := range tt.audio {
+				data, err := os.ReadFile(filepath.Join(dir, "audio", name))
+				if err != nil {
+					t.Error(err)
+					continue
+				}
+				if string(data) != string(fakeAudio(text)) {
+					t.Errorf("audio/%s = %q, want the audio of %q", name, data, text)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkRun measures the per-word overhead of a run: reading the input,
+// the lookups and syntheses through the whole client stack, and writing the
+// output and audio, against fakes that answer at once.
+func BenchmarkRun(b *testing.B) {
+	const words = 200
+	translations := map[string]string{}
+	var input strings.Builder
+	for i := range words {
+		word := fmt.Sprintf("word%d", i)
+		translations[word] = fmt.Sprintf("слово%d", i)
+		fmt.Fprintf(&input, "%s\tdefinition of %s\n", word, word)
+	}
+	path := filepath.Join(b.TempDir(), "words.tsv")
+	if err := os.WriteFile(path, []byte(input.String()), 0644); err != nil {
+		b.Fatal(err)
+	}
+	apis := newFakeAPIs(b, translations)
+	args := append(apis.args(), "-log-level", "quiet", path)
+
+	b.ResetTimer()
+	for range b.N {
+		// Each run starts in a fresh directory, so every word is voiced.
+		if _, err := runMain(b, args...); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*words), "ns/word")
+}
+
+func TestRunLimit(t *testing.T) {
+	translations := map[string]string{}
+	var input strings.Builder
+	for i := range 8 {
+		word := fmt.Sprintf("word%d", i)
+		translations[word] = fmt.Sprintf("слово%d", i)
+		fmt.Fprintf(&input, "%s\tdefinition\n", word)
+	}
+	path := filepath.Join(t.TempDir(), "words.tsv")
+	if err := os.WriteFile(path, []byte(input.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	apis := newFakeAPIs(t, translations)
+	// A failed word doesn't count towards the limit, so the next one is
+	// looked up in its place.
+	delete(translations, "word0")
+	args := append(apis.args(), "-strict", "-limit", "2", "-translate-workers", "4", "-audio-workers", "4", path)
+	dir, err := runMain(t, args...)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	want := []string{"word1;definition;[sound:word1.mp3];слово1", "word2;definition;[sound:word2.mp3];слово2"}
+	if got := readLines(t, filepath.Join(dir, "output.csv")); !slices.Equal(got, want) {
+		t.Errorf("output.csv:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	// The workers finish in any order.
+	slices.Sort(apis.spoken)
+	slices.Sort(apis.lookups)
+	if want := []string{"word1", "word2"}; !slices.Equal(apis.spoken, want) {
+		t.Errorf("synthesized %q, want %q", apis.spoken, want)
+	}
+	if want := []string{"word0", "word1", "word2"}; !slices.Equal(apis.lookups, want) {
+		t.Errorf("looked up %q, want %q", apis.lookups, want)
+	}
+	files, _ := os.ReadDir(filepath.Join(dir, "audio"))
+	if len(files) != 2 {
+		t.Errorf("audio directory has %d files, want 2", len(files))
+	}
+}
+
+func TestRunLimitPostprocessSkip(t *testing.T) {
+	apis := newFakeAPIs(t, map[string]string{"cat": "кошка", "dog": "собака", "fish": "рыба", "bird": "птица"})
+	path := filepath.Join(t.TempDir(), "words.tsv")
+	if err := os.WriteFile(path, []byte("cat\tpet\ndog\tpet\nfish\tpet\nbird\tpet\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// The command answers nonsense for cat, so its row fails.
+	postprocess := `while read -r line; do case "$line" in *'"word":"cat"'*) echo nonsense;; *) echo '{}';; esac; done`
+	args := append(apis.args(), "-limit", "2", "-postprocess", postprocess, "-postprocess-errors", "skip", path)
+	dir, err := runMain(t, args...)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	// A word left out doesn't count towards the limit, so two are written.
+	want := []string{"dog;pet;[sound:dog.mp3];собака", "fish;pet;[sound:fish.mp3];рыба"}
+	if got := readLines(t, filepath.Join(dir, "output.csv")); !slices.Equal(got, want) {
+		t.Errorf("output.csv:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	slices.Sort(apis.spoken)
+	if want := []string{"cat", "dog", "fish"}; !slices.Equal(apis.spoken, want) {
+		t.Errorf("synthesized %q, want %q", apis.spoken, want)
+	}
+}
+
+func TestRunJSONL(t *testing.T) {
+	apis := newFakeAPIs(t, map[string]string{"cat": "кошка", "dog": "собака"})
+	dir := t.TempDir()
+	path := filepath.Join(dir, "words.tsv")
+	if err := os.WriteFile(path, []byte("cat\ta \"small\" animal\ndog\ta pet\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, audioDir := filepath.Join(dir, "deck.jsonl"), filepath.Join(dir, "audio")
+	args := append(apis.args(), "-format", "jsonl", "-out", out, "-audio-dir", audioDir, "-tags", "pets")
+	if _, err := runMain(t, append(args, path)...); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	// No Anki headers: every line is a record keyed by column name.
+	want := []string{
+		`{"word":"cat","example":"a \"small\" animal","sound":"[sound:cat.mp3]","translation":"кошка","tags":"pets"}`,
+		`{"word":"dog","example":"a pet","sound":"[sound:dog.mp3]","translation":"собака","tags":"pets"}`,
+	}
+	if got := readLines(t, out); !slices.Equal(got, want) {
+		t.Errorf("deck.jsonl:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// The rows read back for -verify and -append.
+	if _, err := runMain(t, append(apis.args(), "-verify", "-format", "jsonl", "-out", out, "-audio-dir", audioDir)...); err != nil {
+		t.Errorf("verify: %v", err)
+	}
+	_, err := runMain(t, append(args[:len(args)-2], "-append", path)...)
+	if err == nil || !strings.Contains(err.Error(), "has 5 columns but this run writes 4") {
+		t.Errorf("appending without -tags = %v, want a column count error", err)
+	}
+}
+
+func TestRunWordTransform(t *testing.T) {
+	apis := newFakeAPIs(t, map[string]string{"cat": "кошка"})
+	path := filepath.Join(t.TempDir(), "words.tsv")
+	if err := os.WriteFile(path, []byte("Cats\tpets\nbad\tfirst\nbad\tsecond\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// The command singularizes, logs what it was given, and fails on bad.
+	transform := `read -r w; echo "$w" >> calls; case "$w" in bad) exit 1;; esac; echo "${w%s}"`
+	args := append(apis.args(), "-normalize-case", "title", "-word-transform", transform, path)
+	dir, err := runMain(t, args...)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	// The command gets the lowercase term, not the title-cased word, and
+	// runs once for a word it failed on.
+	if got, want := readLines(t, filepath.Join(dir, "calls")), []string{"cats", "bad"}; !slices.Equal(got, want) {
+		t.Errorf("command ran on %q, want %q", got, want)
+	}
+	want := []string{
+		"Cats;pets;[sound:cat.mp3];кошка",
+		"Bad;first;[sound:bad.mp3];",
+		"Bad;second;[sound:bad.mp3];",
+	}
+	if got := readLines(t, filepath.Join(dir, "output.csv")); !slices.Equal(got, want) {
+		t.Errorf("output.csv:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestRunIndexMultipleInputs(t *testing.T) {
+	apis := newFakeAPIs(t, map[string]string{"cat": "кошка", "dog": "собака"})
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "first.tsv"), filepath.Join(dir, "second.tsv")
+	os.WriteFile(first, []byte("cat\ta small animal\n"), 0644)
+	os.WriteFile(second, []byte("dog\ta pet\n"), 0644)
+	out, err := runMain(t, append(apis.args(), "-include-index", first, second)...)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	// Both words are in row 1 of their file; the file tells them apart.
+	want := []string{
+		first + ":1;cat;a small animal;[sound:cat.mp3];кошка",
+		second + ":1;dog;a pet;[sound:dog.mp3];собака",
+	}
+	if got := readLines(t, filepath.Join(out, "output.csv")); !slices.Equal(got, want) {
+		t.Errorf("output.csv:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestRunExplodeExamplesSpeakExample(t *testing.T) {
+	apis := newFakeAPIs(t, map[string]string{"cat": "кошка", "dog": "собака"})
+	apis.examples["cat"] = []string{"the cat sat", "a black cat", "cats purr"}
+	path := filepath.Join(t.TempDir(), "words.tsv")
+	if err := os.WriteFile(path, []byte("cat\ta small animal\ndog\ta pet\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	args := append(apis.args(), "-explode-examples", "-max-examples", "2", "-speak-example", "-columns", "word,example,example_sound", path)
+	dir, err := runMain(t, args...)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	// Every exploded row speaks its own example; a word without dictionary
+	// examples keeps its definition.
+	audio := map[string]string{
+		lingo.ExampleAudioFile("cat.mp3", "the cat sat"): "the cat sat",
+		lingo.ExampleAudioFile("cat.mp3", "a black cat"): "a black cat",
+		lingo.ExampleAudioFile("dog.mp3", "a pet"):       "a pet",
+	}
+	want := []string{
+		"cat;the cat sat;[sound:" + lingo.ExampleAudioFile("cat.mp3", "the cat sat") + "]",
+		"cat;a black cat;[sound:" + lingo.ExampleAudioFile("cat.mp3", "a black cat") + "]",
+		"dog;a pet;[sound:" + lingo.ExampleAudioFile("dog.mp3", "a pet") + "]",
+	}
+	if got := readLines(t, filepath.Join(dir, "output.csv")); !slices.Equal(got, want) {
+		t.Errorf("output.csv:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	for name, text := range audio {
+		data, err := os.ReadFile(filepath.Join(dir, "audio", name))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if string(data) != string(fakeAudio(text)) {
+			t.Errorf("audio/%s = %q, want the audio of %q", name, data, text)
+		}
+	}
+	if slices.Contains(apis.spoken, "a small animal") || slices.Contains(apis.spoken, "cats purr") {
+		t.Errorf("synthesized %q, want neither the replaced definition nor examples past -max-examples", apis.spoken)
+	}
+}
+
+func TestRunUsageErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string // part of the error
+	}{
+		{
+			name: "subdirectories in the flat media folder",
+			args: []string{"-media-dir", ".", "-audio-naming-template", "{lang}/{word}", "words.tsv"},
+			want: "-audio-naming-template cannot make subdirectories with -media-dir",
+		},
+		{
+			name: "header in JSON Lines",
+			args: []string{"-format", "jsonl", "-header", "words.tsv"},
+			want: "-header only applies to the delimited -format csv and tsv",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := runMain(t, tt.args...)
+			var usage usageError
+			if !errors.As(err, &usage) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("run = %v, want a usage error containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/yalexaner/simply-lingo/lingo"
+)
+
+// manifestName is the file in the audio directory that maps words to their
+// audio files under -hash-filenames, whose names mean nothing to a reader.
+const manifestName = "manifest.tsv"
+
+// updateManifest adds a word<TAB>file line for every audio file of entries to
+// the manifest in audioDir, keeping the lines of earlier runs.
+func updateManifest(audioDir string, entries []lingo.Entry) error {
+	path := filepath.Join(audioDir, manifestName)
+	lines := map[string]bool{}
+	if data, err := os.ReadFile(path); err == nil {
+		scanner := bufio.NewScanner(strings.NewReader(string(data)))
+		for scanner.Scan() {
+			if line := scanner.Text(); line != "" {
+				lines[line] = true
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	for _, e := range entries {
+		if !e.Voiced {
+			continue
+		}
+		if e.AudioFile != "" {
+			lines[e.Word+"\t"+e.AudioFile] = true
+		}
+		if e.ExampleAudioFile != "" {
+			lines[fmt.Sprintf("%s (example)\t%s", e.Word, e.ExampleAudioFile)] = true
+		}
+		for _, name := range e.ExampleAudioFiles {
+			lines[fmt.Sprintf("%s (example)\t%s", e.Word, name)] = true
+		}
+	}
+
+	var b strings.Builder
+	for _, line := range slices.Sorted(maps.Keys(lines)) {
+		b.WriteString(line + "\n")
+	}
+	return lingo.WriteFileAtomic(path, []byte(b.String()))
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yalexaner/simply-lingo/lingo"
+)
+
+// regenerateMissingAudio reads an existing output file and synthesizes audio
+// only for rows whose referenced audio file, or example audio file with
+// -speak-example, is missing or, with -verify-audio, broken. Translations and the output file itself are
+// left untouched. It stops early once ctx is done.
+func regenerateMissingAudio(ctx context.Context, format outputFormat, columns []string, proc *lingo.Processor, audio lingo.AudioSettings, logs *lingo.Logger) (created, failed int, err error) {
+	outputPath := format.path
+	f, err := os.Open(outputPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	reader := format.newReader(f)
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return 0, 0, fmt.Errorf("parsing %s: %w", outputPath, err)
+	}
+
+	wordColumn := columnPosition(columns, columnWord)
+	soundColumn := columnPosition(columns, columnSound)
+	exampleColumn := columnPosition(columns, columnExample)
+	translationColumn := columnPosition(columns, columnTranslation)
+	exampleSoundColumn := columnPosition(columns, columnExampleSound)
+	for i, row := range rows {
+		if ctx.Err() != nil {
+			break
+		}
+		if len(row) <= wordColumn || len(row) <= soundColumn {
+			continue
+		}
+		word := row[wordColumn]
+		filename, ok := strings.CutPrefix(row[soundColumn], "[sound:")
+		filename, ok2 := strings.CutSuffix(filename, "]")
+		if !ok || !ok2 || filename == "" {
+			continue
+		}
+
+		example := cell(row, exampleColumn)
+		e := lingo.Entry{
+			Row:         i + 1,
+			Word:        word,
+			Term:        word,
+			Definition:  example,
+			Translation: cell(row, translationColumn),
+			AudioFile:   filename,
+		}
+
+		// References are written with the sanitized name, possibly with a
+		// numeric suffix, or with -hash-filenames the hash of the spoken
+		// text; anything else (e.g. a hand-edited path) is not ours to create.
+		ours := filename == filepath.Base(filename) && lingo.IsAudioFileName(strings.TrimSuffix(filename, filepath.Ext(filename)), word, audio.ASCIIFilenames)
+		switch {
+		case audio.HashFilenames:
+			text, err := proc.SpeakText(&e)
+			ours = err == nil && filename == proc.HashedAudioFile(&e, text)
+		case audio.NameTemplate != "":
+			// Templated names depend on the word's position and language,
+			// which the output doesn't keep, so any path inside the audio
+			// directory is accepted.
+			ours = filepath.IsLocal(filename)
+		}
+		if !ours {
+			logs.For("audio_skipped", word).Errorf("Row %d: %s is not the audio file name of %s, skipping", i+1, filename, word)
+			continue
+		}
+
+		missing := !audioUsable(filepath.Join(audio.Dir, filename), audio.Verify)
+		if example != "" && audio.SpeakExample {
+			// As above, only the name derived from the example is ours.
+			exampleFile := lingo.ExampleAudioFile(filename, example)
+			if audio.HashFilenames {
+				exampleFile = proc.HashedAudioFile(&e, example)
+			}
+			if cell(row, exampleSoundColumn) != soundField(exampleFile) {
+				logs.For("audio_skipped", word).Errorf("Row %d: example sound of %s does not match its example, skipping", i+1, word)
+				continue
+			}
+			missing = missing || !audioUsable(filepath.Join(audio.Dir, exampleFile), audio.Verify)
+		}
+		if !missing {
+			continue
+		}
+
+		if err := proc.Voice(&e); err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			logs.For("word_failed", word).Errorf("Error generating audio for %s: %v", word, err)
+			failed++
+			continue
+		}
+		if e.AudioPending {
+			// The quota ran out, so no later row can get its audio either.
+			failed++
+			break
+		}
+		created++
+	}
+	return created, failed, nil
+}
+
+// audioUsable reports whether an audio file is present and, with verify,
+// passes lingo.AudioIntact. Errors other than the file not existing count as
+// present so nothing is overwritten.
+func audioUsable(path string, verify bool) bool {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return false
+	}
+	return !verify || lingo.AudioIntact(path)
+}
+
+// cell returns the value at position i of row, or "" when it is missing.
+func cell(row []string, i int) string {
+	if i < 0 || i >= len(row) {
+		return ""
+	}
+	return row[i]
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// outputFormat is a supported output file layout.
+type outputFormat struct {
+	path  string
+	comma rune
+	// ankiSeparator names comma in an Anki "#separator:" file header.
+	ankiSeparator string
+	// jsonl writes every row as a JSON object keyed by column name, the
+	// record -postprocess reads, instead of delimited fields.
+	jsonl bool
+}
+
+// outputFormats maps the -format names to their layouts. The delimited ones
+// are written by csv.Writer, so fields containing the separator, quotes or
+// newlines are quoted the way Anki's importer expects.
+var outputFormats = map[string]outputFormat{
+	"csv":   {path: "output.csv", comma: ';', ankiSeparator: "Semicolon"},
+	"tsv":   {path: "output.tsv", comma: '\t', ankiSeparator: "Tab"},
+	"jsonl": {path: "output.jsonl", jsonl: true},
+}
+
+// rowWriter writes output rows; it is implemented by csv.Writer,
+// quoteAllWriter and jsonlWriter.
+type rowWriter interface {
+	Write(record []string) error
+	Flush()
+	Error() error
+}
+
+// newWriter returns a writer producing rows of columns in format to w. With
+// quoteAll every field is quoted, for importers that reject bare fields;
+// otherwise only fields that need it are.
+func (format outputFormat) newWriter(w io.Writer, columns []string, quoteAll bool) rowWriter {
+	if format.jsonl {
+		return &jsonlWriter{w: bufio.NewWriter(w), columns: columns}
+	}
+	if quoteAll {
+		return &quoteAllWriter{w: bufio.NewWriter(w), comma: format.comma}
+	}
+	writer := csv.NewWriter(w)
+	writer.Comma = format.comma
+	return writer
+}
+
+// quoteAllWriter writes rows like csv.Writer but wraps every field in double
+// quotes, which csv.Writer has no option for. Quotes inside a field are
+// doubled, as csv.Reader and Anki expect.
+type quoteAllWriter struct {
+	w     *bufio.Writer
+	comma rune
+	err   error
+}
+
+func (q *quoteAllWriter) Write(record []string) error {
+	if q.err != nil {
+		return q.err
+	}
+	for i, field := range record {
+		if i > 0 {
+			q.w.WriteRune(q.comma)
+		}
+		q.w.WriteString(`"` + strings.ReplaceAll(field, `"`, `""`) + `"`)
+	}
+	// bufio.Writer errors are sticky, so the last write reports any of them.
+	_, q.err = q.w.WriteString("\n")
+	return q.err
+}
+
+func (q *quoteAllWriter) Flush() {
+	if q.err == nil {
+		q.err = q.w.Flush()
+	}
+}
+
+func (q *quoteAllWriter) Error() error {
+	return q.err
+}
+
+// jsonlWriter writes every row as a line holding a JSON object that maps
+// the columns to their fields, in column order.
+type jsonlWriter struct {
+	w       *bufio.Writer
+	columns []string
+	err     error
+}
+
+func (j *jsonlWriter) Write(record []string) error {
+	if j.err != nil {
+		return j.err
+	}
+	if len(record) != len(j.columns) {
+		return fmt.Errorf("row has %d fields for %d columns", len(record), len(j.columns))
+	}
+	j.w.WriteByte('{')
+	for i, field := range record {
+		if i > 0 {
+			j.w.WriteByte(',')
+		}
+		// Marshaling a string can't fail.
+		key, _ := json.Marshal(j.columns[i])
+		value, _ := json.Marshal(field)
+		j.w.Write(key)
+		j.w.WriteByte(':')
+		j.w.Write(value)
+	}
+	// bufio.Writer errors are sticky, so the last write reports any of them.
+	_, j.err = j.w.WriteString("}\n")
+	return j.err
+}
+
+func (j *jsonlWriter) Flush() {
+	if j.err == nil {
+		j.err = j.w.Flush()
+	}
+}
+
+func (j *jsonlWriter) Error() error {
+	return j.err
+}
+
+// rowReader reads output rows; it is implemented by csv.Reader and
+// jsonlReader.
+type rowReader interface {
+	Read() (record []string, err error)
+	ReadAll() (records [][]string, err error)
+}
+
+// newReader returns a reader parsing rows in format from r. Rows may differ in
+// length, and the Anki file headers at the top are skipped.
+func (format outputFormat) newReader(r io.Reader) rowReader {
+	if format.jsonl {
+		return &jsonlReader{dec: json.NewDecoder(r)}
+	}
+	// Rows are not comments however they start: a word may well be
+	// "#hashtag" or "C#".
+	reader := csv.NewReader(skipAnkiHeaders(r))
+	reader.Comma = format.comma
+	reader.FieldsPerRecord = -1
+	return reader
+}
+
+// ankiHeader matches a file header line of Anki's import format, such as
+// "#separator:semicolon" or "#tags column:5".
+var ankiHeader = regexp.MustCompile(`^#[a-z]+( column)?:`)
+
+// skipAnkiHeaders returns r past the Anki file headers it starts with.
+func skipAnkiHeaders(r io.Reader) io.Reader {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if !ankiHeader.MatchString(line) {
+			// The first row, which goes back in front of the rest.
+			return io.MultiReader(strings.NewReader(line), br)
+		}
+		if err != nil {
+			return br
+		}
+	}
+}
+
+// jsonlReader reads the rows jsonlWriter writes, with their fields in the
+// order of the keys.
+type jsonlReader struct {
+	dec *json.Decoder
+}
+
+func (j *jsonlReader) Read() ([]string, error) {
+	if _, err := j.dec.Token(); err != nil {
+		// io.EOF once every object has been read.
+		return nil, err
+	}
+	var record []string
+	for j.dec.More() {
+		if _, err := j.dec.Token(); err != nil {
+			return nil, err
+		}
+		var field string
+		if err := j.dec.Decode(&field); err != nil {
+			return nil, err
+		}
+		record = append(record, field)
+	}
+	if _, err := j.dec.Token(); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func (j *jsonlReader) ReadAll() ([][]string, error) {
+	var records [][]string
+	for {
+		record, err := j.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+}
+
+// writeAnkiHeaders writes the file headers Anki reads on import: the
+// separator, the deck notes go to (unless deck is empty) and the position of
+// the tags column, if any.
+func (format outputFormat) writeAnkiHeaders(w io.Writer, deck string, columns []string) error {
+	headers := "#separator:" + format.ankiSeparator + "\n"
+	if deck != "" {
+		headers += "#deck:" + deck + "\n"
+	}
+	if i := columnPosition(columns, columnTags); i >= 0 {
+		headers += fmt.Sprintf("#tags column:%d\n", i+1)
+	}
+	_, err := io.WriteString(w, headers)
+	return err
+}
+
+// openOutput opens the output file for writing. With appendMode it keeps the
+// existing rows, after checking they have the same number of columns as the
+// rows about to be written; otherwise the file is truncated. isNew reports
+// whether the file starts out empty. The path "-" stands for stdout.
+func openOutput(format outputFormat, appendMode bool, columns []string) (f *os.File, isNew bool, err error) {
+	if format.path == "-" {
+		return os.Stdout, true, nil
+	}
+	if !appendMode {
+		f, err = os.Create(format.path)
+		return f, true, err
+	}
+
+	if err := checkOutputColumns(format, len(columns)); err != nil {
+		return nil, false, err
+	}
+	f, err = os.OpenFile(format.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, false, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, false, err
+	}
+	return f, info.Size() == 0, nil
+}
+
+// checkOutputColumns verifies that the first row of an existing output file
+// has want columns, so appended rows line up with the existing ones.
+func checkOutputColumns(format outputFormat, want int) error {
+	path := format.path
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := format.newReader(f)
+	record, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+	if len(record) != want {
+		return fmt.Errorf("%s has %d columns but this run writes %d; use the same column flags as the earlier run", path, len(record), want)
+	}
+	return nil
+}
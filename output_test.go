@@ -0,0 +1,26 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewReaderAnkiHeaders(t *testing.T) {
+	format := outputFormats["csv"]
+	var out strings.Builder
+	if err := format.writeAnkiHeaders(&out, "Pets", []string{columnWord, columnTranslation, columnTags}); err != nil {
+		t.Fatal(err)
+	}
+	out.WriteString("#hashtag;хэштег;words\nC#;си-шарп;languages\n")
+
+	// Only the headers at the top are skipped; words starting with # are rows.
+	records, err := format.newReader(strings.NewReader(out.String())).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"#hashtag", "хэштег", "words"}, {"C#", "си-шарп", "languages"}}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("records = %q, want %q", records, want)
+	}
+}
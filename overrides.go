@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/yalexaner/simply-lingo/lingo"
+)
+
+// overrides maps lowercased words to the translations supplied for them.
+type overrides map[string]*lingo.Override
+
+// find returns the override for word, matched case-insensitively.
+func (o overrides) find(word string) *lingo.Override {
+	return o[strings.ToLower(strings.TrimSpace(word))]
+}
+
+// loadOverrides reads the -overrides file. A .json file maps each word to an
+// object such as {"translation": "...", "skip_audio": true}; any other file
+// holds delimited word, translation and optional skip-audio (true/false)
+// columns.
+func loadOverrides(path, charset string) (overrides, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	result := overrides{}
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		var entries map[string]struct {
+			Translation string `json:"translation"`
+			SkipAudio   bool   `json:"skip_audio"`
+		}
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, err
+		}
+		for word, e := range entries {
+			result[strings.ToLower(strings.TrimSpace(word))] = &lingo.Override{Translation: strings.TrimSpace(e.Translation), SkipAudio: e.SkipAudio}
+		}
+		return result, nil
+	}
+
+	text, err := decodeInput(data, charset)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := readDelimitedRows(strings.NewReader(text), sniffDelimiter(text))
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if len(row.cells) < 2 {
+			return nil, fmt.Errorf("line %d: want a word and its translation", row.number)
+		}
+		o := &lingo.Override{Translation: strings.TrimSpace(row.cells[1])}
+		if len(row.cells) > 2 && strings.TrimSpace(row.cells[2]) != "" {
+			o.SkipAudio, err = strconv.ParseBool(strings.TrimSpace(row.cells[2]))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: skip-audio column must be true or false", row.number)
+			}
+		}
+		result[strings.ToLower(strings.TrimSpace(row.cells[0]))] = o
+	}
+	return result, nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+)
+
+// postProcessor passes output records through a long-running external
+// command before they are written, e.g. to add HTML or generate clozes. Each
+// record goes to the command's stdin as one JSON object line mapping column
+// names to fields; the command answers with one line holding an object of
+// the fields to replace, or null to leave the record out. The command's
+// stderr is passed through.
+type postProcessor struct {
+	ctx     context.Context
+	command string
+	timeout time.Duration // longest wait for an answer, 0 for no limit
+
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	lines chan string // answers; closed when the command's stdout ends
+}
+
+func newPostProcessor(ctx context.Context, command string, timeout time.Duration) *postProcessor {
+	return &postProcessor{ctx: ctx, command: command, timeout: timeout}
+}
+
+// start runs the command, which then serves every record until it fails.
+func (p *postProcessor) start() error {
+	cmd := exec.CommandContext(p.ctx, "sh", "-c", p.command)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("starting %q: %w", p.command, err)
+	}
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(nil, 16<<20)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	p.cmd, p.stdin, p.lines = cmd, stdin, lines
+	return nil
+}
+
+// stop kills the command after a failure; the next record starts it again.
+func (p *postProcessor) stop() {
+	if p.cmd == nil {
+		return
+	}
+	p.stdin.Close()
+	p.cmd.Process.Kill()
+	// Wait closes stdout even if a child of the shell still holds it, which
+	// ends the reading goroutine.
+	p.cmd.Wait()
+	for range p.lines {
+	}
+	p.cmd = nil
+}
+
+// close ends the command's input and waits for it to exit.
+func (p *postProcessor) close() error {
+	if p.cmd == nil {
+		return nil
+	}
+	p.stdin.Close()
+	for range p.lines {
+	}
+	err := p.cmd.Wait()
+	p.cmd = nil
+	return err
+}
+
+// process returns row with the fields the command replaced. keep is false
+// when the command left the record out.
+func (p *postProcessor) process(columns, row []string) (result []string, keep bool, err error) {
+	if p.cmd == nil {
+		if err := p.start(); err != nil {
+			return nil, false, err
+		}
+	}
+	fields := make(map[string]string, len(columns))
+	for i, column := range columns {
+		fields[column] = row[i]
+	}
+	line, err := json.Marshal(fields)
+	if err != nil {
+		return nil, false, err
+	}
+	if _, err := p.stdin.Write(append(line, '\n')); err != nil {
+		p.stop()
+		return nil, false, fmt.Errorf("writing to %q: %w", p.command, err)
+	}
+
+	var timeout <-chan time.Time
+	if p.timeout > 0 {
+		timer := time.NewTimer(p.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	var answer string
+	select {
+	case a, ok := <-p.lines:
+		if !ok {
+			p.stop()
+			return nil, false, fmt.Errorf("%q exited without answering", p.command)
+		}
+		answer = a
+	case <-timeout:
+		p.stop()
+		return nil, false, fmt.Errorf("%q did not answer within %s", p.command, p.timeout)
+	}
+
+	if strings.TrimSpace(answer) == "null" {
+		return nil, false, nil
+	}
+	var replaced map[string]string
+	if err := json.Unmarshal([]byte(answer), &replaced); err != nil {
+		// The command is out of step with the records now, so restart it.
+		p.stop()
+		return nil, false, fmt.Errorf("parsing the answer of %q: %w", p.command, err)
+	}
+	result = slices.Clone(row)
+	for column, value := range replaced {
+		i := columnPosition(columns, column)
+		if i < 0 {
+			return nil, false, fmt.Errorf("%q answered with unknown column %q", p.command, column)
+		}
+		result[i] = value
+	}
+	return result, true, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"github.com/yalexaner/simply-lingo/lingo"
+)
+
+// loadSecrets reads the KEY=VALUE lines of a -secrets-file, which uses the
+// .env syntax. A file other users can read is used but warned about.
+func loadSecrets(path string, logs *lingo.Logger) (map[string]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		logs.Warnf("%s can be read by other users; restrict it with chmod 600", path)
+	}
+	return godotenv.Read(path)
+}
+
+// apiKey returns the key called name from secrets, the environment or, when
+// canPrompt is set, from a prompt on the terminal.
+func apiKey(name string, secrets map[string]string, canPrompt bool) (string, error) {
+	if key := firstNonEmpty(secrets[name], os.Getenv(name)); key != "" {
+		return key, nil
+	}
+	if !canPrompt {
+		return "", fmt.Errorf("%s is required; set it in the environment, .env or a -secrets-file", name)
+	}
+	key, err := promptSecret(name)
+	if err != nil {
+		return "", fmt.Errorf("reading %s: %w", name, err)
+	}
+	if key == "" {
+		return "", fmt.Errorf("%s is required", name)
+	}
+	return key, nil
+}
+
+// isTerminal reports whether f is an interactive terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// promptSecret asks for name on stderr and reads a line from the terminal
+// without echoing it. Echo is switched off with stty, so a terminal without
+// stty is not prompted.
+func promptSecret(name string) (string, error) {
+	stty := func(arg string) error {
+		cmd := exec.Command("stty", arg)
+		cmd.Stdin = os.Stdin
+		return cmd.Run()
+	}
+	if err := stty("-echo"); err != nil {
+		return "", fmt.Errorf("hiding input: %w", err)
+	}
+	restore := func() {
+		stty("echo")
+		fmt.Fprintln(os.Stderr)
+	}
+	// Ctrl-C must not leave the terminal without echo.
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt)
+	go func() {
+		if _, ok := <-interrupted; ok {
+			restore()
+			os.Exit(130)
+		}
+	}()
+	defer func() {
+		signal.Stop(interrupted)
+		close(interrupted)
+		restore()
+	}()
+
+	fmt.Fprintf(os.Stderr, "%s: ", name)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+	"unicode/utf8"
+
+	"github.com/yalexaner/simply-lingo/lingo"
+)
+
+// printEstimate prints the lookups, synthesis requests and characters a run
+// over the first limit entries (all of them for 0) would use, without making
+// any of them. With speakTemplate the translations the template speaks are
+// counted as empty.
+func printEstimate(console io.Writer, msgs *lingo.Messages, proc *lingo.Processor, entries []lingo.Entry, limit int, speakTemplate bool, pricePer1000 float64, logs *lingo.Logger) {
+	planned := entries
+	if limit > 0 && len(planned) > limit {
+		planned = planned[:limit]
+	}
+	lookups, requests, chars := 0, 0, 0
+	for i := range planned {
+		e := &planned[i]
+		if e.Override == nil {
+			lookups++
+		}
+		texts, err := proc.PlannedSynthesis(e)
+		if err != nil {
+			logs.For("word_failed", e.Word).Errorf("Error estimating audio for %s: %v", e.Word, err)
+			continue
+		}
+		for _, text := range texts {
+			requests++
+			chars += utf8.RuneCountInString(text)
+		}
+	}
+	fmt.Fprintln(console, clearLine+msgs.Sprintf("Estimate for %d words: %d translation lookups, %d synthesis requests, %d characters to synthesize", len(planned), lookups, requests, chars))
+	if speakTemplate {
+		fmt.Fprintln(console, msgs.Sprintf("Translations in -speak-template are only known after the lookup and were counted as empty"))
+	}
+	if pricePer1000 > 0 {
+		fmt.Fprintln(console, msgs.Sprintf("Estimated synthesis cost: %.2f", pricePer1000*float64(chars)/1000))
+	}
+}
+
+// runSummary is what printSummary reports about a finished run.
+type runSummary struct {
+	run        *deckRun
+	entries    []lingo.Entry
+	inputs     []string
+	inputWords map[string]int // input -> entries read from it
+	deadline   time.Duration
+	stopped    bool // -deadline passed
+	outputName string
+	audioDir   string
+	// report is the verification of the output, nil when it wasn't checked.
+	report        *verifyReport
+	format        outputFormat
+	overridesFile string
+	bundle        string // the bundle written, if any
+}
+
+// printSummary prints what became of the words of a run.
+func printSummary(console io.Writer, msgs *lingo.Messages, s runSummary) {
+	written := s.run.out.written
+	if s.run.limitReached {
+		fmt.Fprintln(console, clearLine+msgs.Sprintf("Stopped early after %d words because of -limit", written))
+	}
+	if s.stopped {
+		fmt.Fprintln(console, clearLine+msgs.Sprintf("Stopped early after %d words because the -deadline of %s passed", written, s.deadline))
+	}
+	fmt.Fprintln(console, clearLine+msgs.Sprintf("Processing complete: %d of %d words written. Output written to %s", written, len(s.entries), s.outputName))
+	if len(s.inputs) > 1 {
+		for _, input := range s.inputs {
+			fmt.Fprintln(console, msgs.Sprintf("  %s: %d words read, %d written", input, s.inputWords[input], s.run.out.writtenWords[input]))
+		}
+	}
+	fmt.Fprintln(console, msgs.Sprintf("Audio files saved to the '%s' directory", s.audioDir))
+	if s.report != nil {
+		s.report.print(console, msgs, s.format, s.audioDir, false)
+	}
+	// Per-word skip messages only show at -log-level verbose, so re-runs
+	// report the existing files here instead.
+	reused, pending, overridden := 0, 0, 0
+	for _, e := range s.entries {
+		if e.AudioReused {
+			reused++
+		}
+		if e.AudioPending {
+			pending++
+		}
+		if e.Override != nil && e.Translated {
+			overridden++
+		}
+	}
+	if reused > 0 {
+		fmt.Fprintln(console, msgs.Sprintf("Skipped %d existing audio files", reused))
+	}
+	if pending > 0 {
+		fmt.Fprintln(console, msgs.Sprintf("Audio was halted because the text-to-speech quota ran out: %d words were written without their audio files, create them with -only-missing-audio once the quota renews", pending))
+	}
+	if overridden > 0 {
+		fmt.Fprintln(console, msgs.Sprintf("%d words were translated from %s without a lookup", overridden, s.overridesFile))
+	}
+	if s.run.failed > 0 {
+		fmt.Fprintln(console, msgs.Sprintf("%d words failed and were left out of the output", s.run.failed))
+	}
+	fmt.Fprintln(console, msgs.Sprintf("%d words had no translation", s.run.emptyTranslations))
+	if s.bundle != "" {
+		fmt.Fprintln(console, msgs.Sprintf("Deck bundled into %s", s.bundle))
+	}
+}
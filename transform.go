@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+	"unicode"
+
+	"github.com/yalexaner/simply-lingo/lingo"
+)
+
+// wordTransformer rewrites words through an external command before they are
+// looked up and synthesized, e.g. to lemmatize them. The command receives the
+// word on stdin and prints the transformed word on stdout.
+type wordTransformer struct {
+	command string
+	cache   map[string]transformed
+}
+
+// transformed is the outcome of transforming a word.
+type transformed struct {
+	word string
+	err  error
+}
+
+func newWordTransformer(command string) *wordTransformer {
+	return &wordTransformer{command: command, cache: map[string]transformed{}}
+}
+
+// transform returns the transformed form of word, running the command only
+// once per distinct word, whether it succeeds or not.
+func (t *wordTransformer) transform(word string) (string, error) {
+	if result, ok := t.cache[word]; ok {
+		return result.word, result.err
+	}
+	result, err := t.run(word)
+	t.cache[word] = transformed{word: result, err: err}
+	return result, err
+}
+
+// run runs the command on word.
+func (t *wordTransformer) run(word string) (string, error) {
+
+	cmd := exec.Command("sh", "-c", t.command)
+	cmd.Stdin = strings.NewReader(word + "\n")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("running %q: %w: %s", t.command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	result := strings.TrimSpace(string(out))
+	if result == "" {
+		return "", fmt.Errorf("running %q: empty output", t.command)
+	}
+	return result, nil
+}
+
+// transformTerm replaces the term of e, the form -normalize-case looks up,
+// with its transformed form, keeping the term if the command fails on it.
+func transformTerm(e *lingo.Entry, t *wordTransformer, logs *lingo.Logger) {
+	term, err := t.transform(e.Term)
+	if err != nil {
+		logs.For("transform_failed", e.Word).Warnf("transforming %s failed, using the original word: %v", e.Term, err)
+		return
+	}
+	e.Term = term
+}
+
+// normalizeCase rewrites the capitalization of word: "lower" lowercases it,
+// "title" capitalizes the first letter of every word and lowercases the rest,
+// and "preserve" leaves it as written.
+func normalizeCase(word, mode string) string {
+	switch mode {
+	case "lower":
+		return strings.ToLower(word)
+	case "title":
+		var b strings.Builder
+		start := true
+		for _, r := range word {
+			if start {
+				b.WriteRune(unicode.ToUpper(r))
+			} else {
+				b.WriteRune(unicode.ToLower(r))
+			}
+			start = unicode.IsSpace(r) || r == '-'
+		}
+		return b.String()
+	}
+	return word
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+
+	"github.com/yalexaner/simply-lingo/lingo"
+)
+
+// soundRef matches the [sound:...] references Anki plays from sound fields.
+var soundRef = regexp.MustCompile(`\[sound:([^\]]+)\]`)
+
+// verifyReport is the result of cross-checking an output file against the
+// audio directory.
+type verifyReport struct {
+	refs     int      // distinct sound references in the output
+	dangling []string // referenced files that are missing or empty
+	orphaned []string // files in the audio directory nothing references
+}
+
+// verifyOutput checks that every sound reference in the output file names a
+// non-empty file in audioDir, and lists the files of audioDir that no row
+// refers to. The -hash-filenames manifest is not counted as orphaned.
+func verifyOutput(format outputFormat, audioDir string) (verifyReport, error) {
+	var report verifyReport
+	f, err := os.Open(format.path)
+	if err != nil {
+		return report, err
+	}
+	defer f.Close()
+
+	referenced, err := checkRefs(format.newReader(f), audioDir, &report)
+	if err != nil {
+		return report, fmt.Errorf("parsing %s: %w", format.path, err)
+	}
+
+	// -audio-naming-template may put files in subdirectories, which sound
+	// references name with slashes.
+	err = filepath.WalkDir(audioDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == audioDir && errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(audioDir, path)
+		if err != nil {
+			return err
+		}
+		if name := filepath.ToSlash(rel); name != manifestName && !referenced[name] {
+			report.orphaned = append(report.orphaned, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+	slices.Sort(report.dangling)
+	return report, nil
+}
+
+// checkRefs reads the rows of reader, counting their distinct sound
+// references in report and listing the ones whose file in audioDir is
+// missing or empty as dangling. It returns the names referenced.
+func checkRefs(reader rowReader, audioDir string, report *verifyReport) (map[string]bool, error) {
+	referenced := map[string]bool{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return referenced, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range record {
+			for _, m := range soundRef.FindAllStringSubmatch(field, -1) {
+				name := m[1]
+				if referenced[name] {
+					continue
+				}
+				referenced[name] = true
+				report.refs++
+				if info, err := os.Stat(filepath.Join(audioDir, name)); err != nil || info.Size() == 0 {
+					report.dangling = append(report.dangling, name)
+				}
+			}
+		}
+	}
+}
+
+// print writes the report to w, listing every dangling reference and, when
+// listOrphans is set, every orphaned file.
+func (r verifyReport) print(w io.Writer, msgs *lingo.Messages, format outputFormat, audioDir string, listOrphans bool) {
+	fmt.Fprintln(w, msgs.Sprintf("Checked %d sound references in %s: %d missing or empty, %d files in '%s' not referenced", r.refs, format.path, len(r.dangling), len(r.orphaned), audioDir))
+	for _, name := range r.dangling {
+		fmt.Fprintln(w, msgs.Sprintf("  missing or empty: %s", name))
+	}
+	if listOrphans {
+		for _, name := range r.orphaned {
+			fmt.Fprintln(w, msgs.Sprintf("  not referenced: %s", name))
+		}
+	}
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// readXLSXStream reads the rows of the first sheet of an Excel workbook like
+// readXLSXRows, but with streamXLSXRows, without loading the whole workbook.
+func readXLSXStream(name string) ([]inputRow, error) {
+	var rows []inputRow
+	err := streamXLSXRows(name, func(row inputRow) bool {
+		rows = append(rows, row)
+		return true
+	})
+	return rows, err
+}
+
+// streamXLSXRows decodes the first sheet of an Excel workbook one row at a
+// time, passing each row readXLSXRows would return to yield as soon as it is
+// read, so very large workbooks fit in memory and their words can be
+// processed while the rest is still being read. Only the shared strings are
+// kept whole. Numbers are read as stored, without their display format.
+// Reading stops early when yield returns false.
+func streamXLSXRows(name string, yield func(inputRow) bool) error {
+	zr, err := zip.OpenReader(name)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	sheet, err := firstSheet(files)
+	if err != nil {
+		return err
+	}
+	shared, err := readSharedStrings(files["xl/sharedStrings.xml"])
+	if err != nil {
+		return fmt.Errorf("reading shared strings: %w", err)
+	}
+	// Merged ranges are listed after the cells, so they are read first in a
+	// separate pass.
+	merges, err := readMergedRanges(sheet)
+	if err != nil {
+		return fmt.Errorf("reading merged cells: %w", err)
+	}
+
+	r, err := sheet.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	m := newMergeFiller(merges)
+	// emit passes a row on and reports whether to keep reading.
+	emit := func(number int, cells []string, heading bool) bool {
+		m.end(number)
+		return heading || isBlankRow(cells) || yield(inputRow{number: number, cells: cells})
+	}
+	// emitMerged emits a row missing from the sheet, which may still be
+	// covered by a merged range.
+	emitMerged := func(number int) bool {
+		var cells []string
+		heading := m.fill(number, &cells)
+		return emit(number, cells, heading)
+	}
+	decoder := xml.NewDecoder(r)
+	last := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+		var row xlsxRow
+		if err := decoder.DecodeElement(&row, &start); err != nil {
+			return err
+		}
+		number := row.Number
+		if number == 0 {
+			number = last + 1
+		}
+		for n := last + 1; n < number; n++ {
+			if !emitMerged(n) {
+				return nil
+			}
+		}
+		var cells []string
+		heading := m.fill(number, &cells)
+		for i, c := range row.Cells {
+			column := i
+			if c.Ref != "" {
+				column = cellColumn(c.Ref)
+			}
+			value, err := c.value(shared)
+			if err != nil {
+				return fmt.Errorf("row %d: %w", number, err)
+			}
+			setCell(&cells, column, value)
+			if m.start(number, column, value, &cells) {
+				heading = true
+			}
+		}
+		if !emit(number, cells, heading) {
+			return nil
+		}
+		last = number
+	}
+	for n := last + 1; n <= m.lastRow(); n++ {
+		if !emitMerged(n) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// firstSheet finds the worksheet listed first in the workbook.
+func firstSheet(files map[string]*zip.File) (*zip.File, error) {
+	var workbook struct {
+		Sheets []struct {
+			RelID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := decodeZipXML(files["xl/workbook.xml"], &workbook); err != nil {
+		return nil, fmt.Errorf("reading the workbook: %w", err)
+	}
+	if len(workbook.Sheets) == 0 {
+		return nil, fmt.Errorf("no sheets found in the Excel file")
+	}
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := decodeZipXML(files["xl/_rels/workbook.xml.rels"], &rels); err != nil {
+		return nil, fmt.Errorf("reading the workbook relationships: %w", err)
+	}
+	for _, rel := range rels.Relationships {
+		if rel.ID != workbook.Sheets[0].RelID {
+			continue
+		}
+		// Targets are relative to the workbook unless they start at the root.
+		target := strings.TrimPrefix(rel.Target, "/")
+		if !strings.HasPrefix(rel.Target, "/") {
+			target = path.Join("xl", rel.Target)
+		}
+		if f := files[target]; f != nil {
+			return f, nil
+		}
+		return nil, fmt.Errorf("the first sheet %s is missing", target)
+	}
+	return nil, fmt.Errorf("the first sheet is not in the workbook relationships")
+}
+
+// decodeZipXML unmarshals the XML file f of a workbook into v.
+func decodeZipXML(f *zip.File, v any) error {
+	if f == nil {
+		return fmt.Errorf("file missing")
+	}
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return xml.NewDecoder(r).Decode(v)
+}
+
+// xlsxText is a string of a workbook, plain or split into formatted runs.
+// Phonetic hints are left out.
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	s := t.T
+	for _, run := range t.Runs {
+		s += run.T
+	}
+	return s
+}
+
+// readSharedStrings reads the strings cells refer to by index. A workbook
+// without any has no shared strings file.
+func readSharedStrings(f *zip.File) ([]string, error) {
+	if f == nil {
+		return nil, nil
+	}
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	var shared []string
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return shared, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local == "si" {
+			var text xlsxText
+			if err := decoder.DecodeElement(&text, &start); err != nil {
+				return nil, err
+			}
+			shared = append(shared, text.String())
+		}
+	}
+}
+
+// xlsxRow is a row of a worksheet.
+type xlsxRow struct {
+	Number int        `xml:"r,attr"` // 1-based, 0 when left out
+	Cells  []xlsxCell `xml:"c"`
+}
+
+// xlsxCell is a cell of a worksheet.
+type xlsxCell struct {
+	Ref    string   `xml:"r,attr"` // e.g. "B2", empty when left out
+	Type   string   `xml:"t,attr"`
+	Value  string   `xml:"v"`
+	Inline xlsxText `xml:"is"`
+}
+
+// value returns the text of c, looking shared strings up in shared.
+func (c xlsxCell) value(shared []string) (string, error) {
+	switch c.Type {
+	case "s":
+		if c.Value == "" {
+			return "", nil
+		}
+		i, err := strconv.Atoi(c.Value)
+		if err != nil || i < 0 || i >= len(shared) {
+			return "", fmt.Errorf("cell %s refers to missing shared string %q", c.Ref, c.Value)
+		}
+		return shared[i], nil
+	case "inlineStr":
+		return c.Inline.String(), nil
+	case "b":
+		if c.Value == "1" {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	}
+	return c.Value, nil
+}
+
+// cellColumn returns the 0-based column of a cell reference such as "AB12".
+func cellColumn(ref string) int {
+	column := 0
+	for _, r := range strings.ToUpper(ref) {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		column = column*26 + int(r-'A'+1)
+	}
+	return column - 1
+}
+
+// mergedRange is a range of merged cells, 1-based rows and 0-based columns.
+type mergedRange struct {
+	top, left, bottom, right int
+}
+
+// readMergedRanges reads the merged ranges of a worksheet.
+func readMergedRanges(sheet *zip.File) ([]mergedRange, error) {
+	r, err := sheet.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	var merges []mergedRange
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return merges, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "mergeCell" {
+			continue
+		}
+		for _, attr := range start.Attr {
+			if attr.Name.Local != "ref" {
+				continue
+			}
+			from, to, _ := strings.Cut(attr.Value, ":")
+			if to == "" {
+				to = from
+			}
+			merges = append(merges, mergedRange{
+				top: cellRow(from), left: cellColumn(from),
+				bottom: cellRow(to), right: cellColumn(to),
+			})
+		}
+	}
+}
+
+// cellRow returns the 1-based row of a cell reference such as "AB12".
+func cellRow(ref string) int {
+	n, _ := strconv.Atoi(strings.TrimLeft(strings.ToUpper(ref), "ABCDEFGHIJKLMNOPQRSTUVWXYZ"))
+	return n
+}
+
+// mergeFiller spreads the value of each merged range's top-left cell over
+// the range as the rows stream by, the way readXLSXRows does for a loaded
+// sheet: the merged value is filled in before the covered cells are read,
+// so their own values don't replace it.
+type mergeFiller struct {
+	byCorner map[[2]int]mergedRange // top-left row and column -> range
+	active   map[mergedRange]string // ranges whose top row was read -> value
+}
+
+func newMergeFiller(merges []mergedRange) *mergeFiller {
+	m := &mergeFiller{byCorner: map[[2]int]mergedRange{}, active: map[mergedRange]string{}}
+	for _, merge := range merges {
+		m.byCorner[[2]int{merge.top, merge.left}] = merge
+	}
+	return m
+}
+
+// start notes the value of the cell at row and column in case it starts a
+// merged range, and fills the rest of the range in row. It reports whether
+// that makes row a heading, see cover.
+func (m *mergeFiller) start(row, column int, value string, cells *[]string) bool {
+	merge, ok := m.byCorner[[2]int{row, column}]
+	if !ok {
+		return false
+	}
+	m.active[merge] = value
+	return cover(merge, value, cells)
+}
+
+// fill fills the cells of row covered by ranges started in earlier rows. It
+// reports whether that makes row a heading, see cover.
+func (m *mergeFiller) fill(row int, cells *[]string) (heading bool) {
+	for merge, value := range m.active {
+		if row > merge.top && row <= merge.bottom && cover(merge, value, cells) {
+			heading = true
+		}
+	}
+	return heading
+}
+
+// end forgets the ranges that end at row.
+func (m *mergeFiller) end(row int) {
+	for merge := range m.active {
+		if merge.bottom <= row {
+			delete(m.active, merge)
+		}
+	}
+}
+
+// cover fills the columns of merge in a row with value and reports whether
+// the row is a heading: its word is merged with the cells next to it.
+func cover(merge mergedRange, value string, cells *[]string) bool {
+	for column := merge.left; column <= merge.right; column++ {
+		setCell(cells, column, value)
+	}
+	return merge.left == 0 && merge.right > 0
+}
+
+// lastRow returns the bottom row of the merged ranges still being filled, or
+// 0 if there are none.
+func (m *mergeFiller) lastRow() int {
+	last := 0
+	for merge := range m.active {
+		last = max(last, merge.bottom)
+	}
+	return last
+}